@@ -2,12 +2,15 @@ package motan
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	cluster "github.com/weibocom/motan-go/cluster"
@@ -43,8 +46,14 @@ type Agent struct {
 	agentPortService  map[int]motan.Exporter
 	agentPortServer   map[int]motan.Server
 	serviceRegistries map[string]motan.Registry // all registries used for services
+	serviceExporters  map[string]*mserver.DefaultExporter
+	serviceLock       sync.Mutex
 
 	manageHandlers map[string]http.Handler
+
+	clusterLock     sync.RWMutex     // guards clustermap
+	dynamicClusters *dynamicClusters // nil if dynamic cluster is not enabled
+	reloadLock      sync.Mutex
 }
 
 func NewAgent(extfactory motan.ExtentionFactory) *Agent {
@@ -59,6 +68,7 @@ func NewAgent(extfactory motan.ExtentionFactory) *Agent {
 	agent.agentPortService = make(map[int]motan.Exporter)
 	agent.agentPortServer = make(map[int]motan.Server)
 	agent.serviceRegistries = make(map[string]motan.Registry)
+	agent.serviceExporters = make(map[string]*mserver.DefaultExporter)
 	agent.status = http.StatusOK
 	agent.manageHandlers = make(map[string]http.Handler)
 	return agent
@@ -73,9 +83,14 @@ func (a *Agent) StartMotanAgent() {
 	a.SetSanpshotConf()
 	a.initAgentURL()
 	a.initClusters()
+	a.initDynamicClusters()
 	a.startServerAgent()
 	go a.startMServer()
+	if port := a.agentURL.GetIntValue(HTTPGatewayPortKey, 0); port > 0 {
+		go a.startHTTPGateway(int(port), a.agentURL.GetParam(HTTPGatewayPrefixKey, "/"))
+	}
 	go a.registerAgent()
+	go a.watchReloadSignal()
 	f, err := os.Create(a.pidfile)
 	if err != nil {
 		vlog.Errorf("create file %s fail.\n", a.pidfile)
@@ -139,18 +154,47 @@ func (a *Agent) initContext() {
 }
 
 func (a *Agent) initClusters() {
-	var mapKey string
 	for _, url := range a.Context.RefersURLs {
-		if url.Parameters[motan.ApplicationKey] == "" {
-			url.Parameters[motan.ApplicationKey] = a.agentURL.Parameters[motan.ApplicationKey]
-		}
-		mapKey = getClusterKey(url.Group, url.GetStringParamsWithDefault(motan.VersionKey, "0.1"), url.Protocol, url.Path)
-		c := cluster.NewCluster(url, true)
-		c.SetExtFactory(a.extFactory)
-		c.Context = a.Context
-		c.InitCluster()
-		a.clustermap[mapKey] = c
+		c := a.newCluster(url, a.Context)
+		a.clusterLock.Lock()
+		a.clustermap[getURLClusterKey(url)] = c
+		a.clusterLock.Unlock()
+	}
+}
+
+// newCluster creates and inits the refer cluster of url. the agent application is used if url has no application
+func (a *Agent) newCluster(url *motan.URL, context *motan.Context) *cluster.MotanCluster {
+	if url.Parameters[motan.ApplicationKey] == "" {
+		url.Parameters[motan.ApplicationKey] = a.agentURL.Parameters[motan.ApplicationKey]
+	}
+	c := cluster.NewCluster(url, true)
+	c.SetExtFactory(a.extFactory)
+	c.Context = context
+	c.InitCluster()
+	return c
+}
+
+// getCluster returns the refer cluster of the request and the cluster key. if dynamic cluster is enabled,
+// the cluster is created when it is not configured.
+func (a *Agent) getCluster(request motan.Request) (*cluster.MotanCluster, string) {
+	ck := getRequestClusterKey(request)
+	if a.dynamicClusters != nil {
+		return a.dynamicClusters.getCluster(ck, request), ck
+	}
+	a.clusterLock.RLock()
+	defer a.clusterLock.RUnlock()
+	return a.clustermap[ck], ck
+}
+
+// getClusters returns a snapshot of all refer clusters
+func (a *Agent) getClusters() map[string]*cluster.MotanCluster {
+	a.clusterLock.RLock()
+	defer a.clusterLock.RUnlock()
+	clusters := make(map[string]*cluster.MotanCluster, len(a.clustermap))
+	for k, c := range a.clustermap {
+		clusters[k] = c
 	}
+	return clusters
 }
 
 func (a *Agent) SetSanpshotConf() {
@@ -200,17 +244,20 @@ func (a *Agent) initAgentURL() {
 }
 
 func (a *Agent) startAgent() {
-	url := &motan.URL{Port: a.port}
+	url := &motan.URL{Port: a.port, Parameters: a.agentURL.Copy().Parameters} // worker pool settings are from agent conf
 	handler := &agentMessageHandler{agent: a}
 	server := &mserver.MotanServer{URL: url}
 	server.SetMessageHandler(handler)
+	if prefix := a.agentURL.GetParam(HTTPGatewayPrefixKey, ""); prefix != "" && a.agentURL.GetIntValue(HTTPGatewayPortKey, 0) <= 0 {
+		server.SetHTTPHandler(newHTTPGateway(a, prefix)) // http gateway shares the agent port
+	}
 	vlog.Infof("Motan agent is started. port:%d\n", a.port)
 	fmt.Println("Motan agent start.")
+	a.agentServer = server
 	err := server.Open(true, true, handler, a.extFactory)
 	if err != nil {
 		vlog.Fatalf("start agent fail. port :%d, err: %v\n", a.port, err)
 	}
-	a.agentServer = server
 	fmt.Println("Motan agent start fail!")
 }
 
@@ -246,12 +293,7 @@ func (a *agentMessageHandler) Call(request motan.Request) (res motan.Response) {
 		application := a.agent.agentURL.GetParam(motan.ApplicationKey, "")
 		request.SetAttachment(mpro.MSource, application)
 	}
-	version := "0.1"
-	if request.GetAttachment(mpro.MVersion) != "" {
-		version = request.GetAttachment(mpro.MVersion)
-	}
-	ck := getClusterKey(request.GetAttachment(mpro.MGroup), version, request.GetAttachment(mpro.MProxyProtocol), request.GetAttachment(mpro.MPath))
-	if motanCluster := a.agent.clustermap[ck]; motanCluster != nil {
+	if motanCluster, ck := a.agent.getCluster(request); motanCluster != nil {
 		res = motanCluster.Call(request)
 		if res == nil {
 			vlog.Warningf("motanCluster Call return nil. cluster:%s\n", ck)
@@ -275,58 +317,153 @@ func (a *agentMessageHandler) GetProvider(serviceName string) motan.Provider {
 }
 
 func (a *Agent) startServerAgent() {
-	globalContext := a.Context
-	for _, url := range globalContext.ServiceURLs {
-		export := url.GetParam(motan.ExportKey, "")
-		url.Protocol, url.Port, _ = motan.ParseExportInfo(export)
-		url.Host = motan.GetLocalIP()
-		application := url.GetParam(motan.ApplicationKey, "")
-		if application == "" {
-			application = a.agentURL.GetParam(motan.ApplicationKey, "")
-			url.PutParam(motan.ApplicationKey, application)
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	for _, url := range a.Context.ServiceURLs {
+		if err := a.doExportService(url.Copy()); err != nil { // keep the configured url for config reload
+			vlog.Errorf("service export fail! url:%v, err:%v\n", url, err)
 		}
-		exporter := &mserver.DefaultExporter{}
-		provider := a.extFactory.GetProvider(url)
-		if provider == nil {
-			vlog.Errorf("Didn't have a %s provider, url:%+v\n", url.Protocol, url)
-			return
+	}
+}
+
+// ExportService export a service by url at runtime. the export port will be opened if it is not used by other services.
+// the service is served even if it fails to register to some registries, and the error is returned.
+func (a *Agent) ExportService(url *motan.URL) error {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	return a.doExportService(url)
+}
+
+func (a *Agent) doExportService(url *motan.URL) error {
+	if url.Path == "" {
+		return errors.New("service path is empty")
+	}
+	if _, ok := a.serviceExporters[url.Path]; ok {
+		return errors.New("service is already exported: " + url.Path)
+	}
+	if url.Parameters == nil {
+		url.Parameters = make(map[string]string)
+	}
+	export := url.GetParam(motan.ExportKey, "")
+	var err error
+	url.Protocol, url.Port, err = motan.ParseExportInfo(export)
+	if err != nil {
+		return err
+	}
+	url.Host = motan.GetLocalIP()
+	application := url.GetParam(motan.ApplicationKey, "")
+	if application == "" {
+		application = a.agentURL.GetParam(motan.ApplicationKey, "")
+		url.PutParam(motan.ApplicationKey, application)
+	}
+	exporter := &mserver.DefaultExporter{Switcher: func() bool {
+		return a.status == http.StatusOK
+	}}
+	provider := a.extFactory.GetProvider(url)
+	if provider == nil {
+		vlog.Errorf("Didn't have a %s provider, url:%+v\n", url.Protocol, url)
+		return errors.New("provider not found for service " + url.Path)
+	}
+	motan.CanSetContext(provider, a.Context)
+	motan.CanSetExtFactory(provider, a.extFactory)
+	motan.Initialize(provider)
+	provider = mserver.WarperWithFilter(provider, a.extFactory)
+	exporter.SetProvider(provider)
+	server := a.agentPortServer[url.Port]
+	if server == nil {
+		server = a.extFactory.GetServer(url)
+		handler := &serverAgentMessageHandler{}
+		motan.Initialize(handler)
+		handler.AddProvider(provider)
+		err := server.Open(false, true, handler, a.extFactory)
+		if err != nil {
+			vlog.Errorf("start server agent fail. port :%d, err: %v\n", url.Port, err)
+			provider.Destroy()
+			return err
 		}
-		motan.CanSetContext(provider, globalContext)
-		motan.Initialize(provider)
-		provider = mserver.WarperWithFilter(provider, a.extFactory)
-		exporter.SetProvider(provider)
-		server := a.agentPortServer[url.Port]
-		if server == nil {
-			server = a.extFactory.GetServer(url)
-			handler := &serverAgentMessageHandler{}
-			motan.Initialize(handler)
-			handler.AddProvider(provider)
-			err := server.Open(false, true, handler, a.extFactory)
-			if err != nil {
-				vlog.Fatalf("start server agent fail. port :%d, err: %v\n", url.Port, err)
-			}
-			a.agentPortServer[url.Port] = server
-		} else if canShareChannel(*url, *server.GetURL()) {
-			server.GetMessageHandler().AddProvider(provider)
+		a.agentPortServer[url.Port] = server
+	} else if canShareChannel(*url, *server.GetURL()) {
+		server.GetMessageHandler().AddProvider(provider)
+	} else {
+		provider.Destroy()
+		return fmt.Errorf("can not share channel with port %d", url.Port)
+	}
+	err = exporter.Export(server, a.extFactory, a.Context)
+	if err != nil {
+		vlog.Errorf("service export fail. url:%v, err:%v\n", url, err)
+		server.GetMessageHandler().RmProvider(provider)
+		provider.Destroy()
+		a.closeIdleServer(url.Port)
+		return err
+	}
+	a.serviceExporters[url.Path] = exporter
+	vlog.Infof("service export success. url:%v\n", url)
+	for _, r := range exporter.Registrys {
+		rid := r.GetURL().GetIdentity()
+		if _, ok := a.serviceRegistries[rid]; !ok {
+			a.serviceRegistries[rid] = r
 		}
-		err := exporter.Export(server, a.extFactory, globalContext)
-		if err != nil {
-			vlog.Errorf("service export fail! url:%v, err:%v\n", url, err)
-		} else {
-			vlog.Infof("service export success. url:%v\n", url)
-			for _, r := range exporter.Registrys {
-				rid := r.GetURL().GetIdentity()
-				if _, ok := a.serviceRegistries[rid]; !ok {
-					a.serviceRegistries[rid] = r
-				}
-			}
+	}
+	return nil
+}
+
+// UnexportService unregister the service from its registries and remove it from server.
+// the export port will be closed if no service left on it.
+func (a *Agent) UnexportService(path string) error {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	exporter := a.serviceExporters[path]
+	if exporter == nil {
+		return errors.New("service is not exported: " + path)
+	}
+	delete(a.serviceExporters, path)
+	exporter.Unexport()
+	exporter.GetProvider().Destroy()
+	a.closeIdleServer(exporter.GetProvider().GetURL().Port)
+	removeUnusedRegistries(a.serviceRegistries, exporter, a.serviceExporters)
+	vlog.Infof("service unexport success. path:%s\n", path)
+	return nil
+}
+
+// closeIdleServer closes the server agent of the port if no service is on it
+func (a *Agent) closeIdleServer(port int) {
+	if server := a.agentPortServer[port]; server != nil {
+		if lister, ok := server.GetMessageHandler().(motan.ProviderLister); ok && len(lister.GetProviders()) == 0 {
+			server.Destroy()
+			delete(a.agentPortServer, port)
+			vlog.Infof("server agent port is closed because no service on it. port:%d\n", port)
 		}
 	}
+}
 
+// GetExportServices returns urls of all exported services sorted by path
+func (a *Agent) GetExportServices() []*motan.URL {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	urls := make([]*motan.URL, 0, len(a.serviceExporters))
+	for _, exporter := range a.serviceExporters {
+		urls = append(urls, exporter.GetProvider().GetURL())
+	}
+	sort.Sort(urlsByPath(urls))
+	return urls
+}
+
+// urlsByPath sorts urls by path
+type urlsByPath []*motan.URL
+
+func (u urlsByPath) Len() int {
+	return len(u)
+}
+func (u urlsByPath) Swap(i, j int) {
+	u[i], u[j] = u[j], u[i]
+}
+func (u urlsByPath) Less(i, j int) bool {
+	return u[i].Path < u[j].Path
 }
 
 type serverAgentMessageHandler struct {
 	providers map[string]motan.Provider
+	lock      sync.RWMutex
 }
 
 func (sa *serverAgentMessageHandler) Initialize() {
@@ -334,7 +471,7 @@ func (sa *serverAgentMessageHandler) Initialize() {
 }
 
 func (sa *serverAgentMessageHandler) Call(request motan.Request) (res motan.Response) {
-	p := sa.providers[request.GetServiceName()]
+	p := sa.GetProvider(request.GetServiceName())
 	if p != nil {
 		return p.Call(request)
 	}
@@ -343,20 +480,53 @@ func (sa *serverAgentMessageHandler) Call(request motan.Request) (res motan.Resp
 }
 
 func (sa *serverAgentMessageHandler) AddProvider(p motan.Provider) error {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
 	sa.providers[p.GetPath()] = p
 	return nil
 }
 
-func (sa *serverAgentMessageHandler) RmProvider(p motan.Provider) {}
+func (sa *serverAgentMessageHandler) RmProvider(p motan.Provider) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	if sp := sa.providers[p.GetPath()]; sp != nil && sp == p {
+		delete(sa.providers, p.GetPath())
+	}
+}
 
 func (sa *serverAgentMessageHandler) GetProvider(serviceName string) motan.Provider {
-	return nil
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	return sa.providers[serviceName]
+}
+
+func (sa *serverAgentMessageHandler) GetProviders() []motan.Provider {
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	providers := make([]motan.Provider, 0, len(sa.providers))
+	for _, p := range sa.providers {
+		providers = append(providers, p)
+	}
+	return providers
 }
 
 func getClusterKey(group, version, protocol, path string) string {
 	return group + "_" + version + "_" + protocol + "_" + path
 }
 
+func getURLClusterKey(url *motan.URL) string {
+	return getClusterKey(url.Group, url.GetStringParamsWithDefault(motan.VersionKey, "0.1"), url.Protocol, url.Path)
+}
+
+// getRequestClusterKey get the cluster key from the routing attachments of request
+func getRequestClusterKey(request motan.Request) string {
+	version := "0.1"
+	if request.GetAttachment(mpro.MVersion) != "" {
+		version = request.GetAttachment(mpro.MVersion)
+	}
+	return getClusterKey(request.GetAttachment(mpro.MGroup), version, request.GetAttachment(mpro.MProxyProtocol), request.GetAttachment(mpro.MPath))
+}
+
 func initLog(logdir string) {
 	fmt.Printf("use log dir:%s\n", logdir)
 	flag.Set("log_dir", logdir)
@@ -379,7 +549,7 @@ func (a *AgentListener) NotifyCommand(registryURL *motan.URL, commandType int, c
 	//TODO notify according cluster
 	if commandInfo != a.CurrentCommandInfo {
 		a.CurrentCommandInfo = commandInfo
-		for _, cls := range a.agent.clustermap {
+		for _, cls := range a.agent.getClusters() {
 			for _, registry := range cls.Registrys {
 				if cr, ok := registry.(motan.CommandNotifyListener); ok {
 					cr.NotifyCommand(registryURL, cluster.AgentCmd, commandInfo)
@@ -416,6 +586,27 @@ func (a *Agent) startMServer() {
 	if _, ok := a.manageHandlers["/getReferService"]; !ok {
 		a.manageHandlers["/getReferService"] = http.HandlerFunc(a.getReferServiceHandler)
 	}
+	if _, ok := a.manageHandlers["/getConnections"]; !ok {
+		a.manageHandlers["/getConnections"] = http.HandlerFunc(a.getConnectionsHandler)
+	}
+	if _, ok := a.manageHandlers["/getServices"]; !ok {
+		a.manageHandlers["/getServices"] = http.HandlerFunc(a.getServicesHandler)
+	}
+	if _, ok := a.manageHandlers["/getLocality"]; !ok {
+		a.manageHandlers["/getLocality"] = http.HandlerFunc(a.getLocalityHandler)
+	}
+	if _, ok := a.manageHandlers["/exportService"]; !ok {
+		a.manageHandlers["/exportService"] = http.HandlerFunc(a.exportServiceHandler)
+	}
+	if _, ok := a.manageHandlers["/unexportService"]; !ok {
+		a.manageHandlers["/unexportService"] = http.HandlerFunc(a.unexportServiceHandler)
+	}
+	if _, ok := a.manageHandlers["/getExportServices"]; !ok {
+		a.manageHandlers["/getExportServices"] = http.HandlerFunc(a.getExportServicesHandler)
+	}
+	if _, ok := a.manageHandlers["/reloadConfig"]; !ok {
+		a.manageHandlers["/reloadConfig"] = http.HandlerFunc(a.reloadConfigHandler)
+	}
 	for k, v := range a.manageHandlers {
 		http.Handle(k, v)
 		vlog.Infof("add manage server handle path:%s\n", k)
@@ -461,7 +652,7 @@ func (a *Agent) getConfigHandler(w http.ResponseWriter, r *http.Request) {
 func (a *Agent) getReferServiceHandler(w http.ResponseWriter, r *http.Request) {
 
 	mbody := body{Service: []rpcService{}}
-	for _, cls := range a.clustermap {
+	for _, cls := range a.getClusters() {
 		rpc := cls.GetURL().Path
 		available := cls.IsAvailable()
 		mbody.Service = append(mbody.Service, rpcService{Name: rpc, Status: available})
@@ -474,8 +665,130 @@ func (a *Agent) getReferServiceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type clusterLocality struct {
+	Cluster  string                `json:"cluster"`
+	Locality *cluster.LocalityInfo `json:"locality"`
+}
+
+// clusterLocalities sorts localities by cluster
+type clusterLocalities []clusterLocality
+
+func (c clusterLocalities) Len() int {
+	return len(c)
+}
+func (c clusterLocalities) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+func (c clusterLocalities) Less(i, j int) bool {
+	return c[i].Cluster < c[j].Cluster
+}
+
+// return locality decisions of refer clusters which enable locality
+func (a *Agent) getLocalityHandler(w http.ResponseWriter, r *http.Request) {
+	clusters := a.getClusters()
+	localities := make([]clusterLocality, 0, len(clusters))
+	for key, c := range clusters {
+		if info := c.GetLocality(); info != nil {
+			localities = append(localities, clusterLocality{Cluster: key, Locality: info})
+		}
+	}
+	sort.Sort(clusterLocalities(localities))
+	if data, err := json.Marshal(localities); err == nil {
+		w.Write(data)
+	} else {
+		w.Write([]byte("error."))
+	}
+}
+
+// exportServiceHandler export a service. 'path' and 'group' are the url fields, other form values are url parameters.
+// e.g. /exportService?path=com.weibo.Test&group=test&export=motan2:8100&provider=http&registry=zk
+func (a *Agent) exportServiceHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	url := &motan.URL{Path: r.Form.Get("path"), Group: r.Form.Get("group"), Parameters: make(map[string]string)}
+	for k, v := range r.Form {
+		if k != "path" && k != "group" && len(v) > 0 {
+			url.Parameters[k] = v[0]
+		}
+	}
+	if err := a.ExportService(url); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("export service fail. err:" + err.Error()))
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (a *Agent) unexportServiceHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.UnexportService(r.FormValue("path")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unexport service fail. err:" + err.Error()))
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (a *Agent) getExportServicesHandler(w http.ResponseWriter, r *http.Request) {
+	urls := a.GetExportServices()
+	services := make([]string, 0, len(urls))
+	for _, url := range urls {
+		services = append(services, url.ToExtInfo())
+	}
+	if data, err := json.Marshal(services); err == nil {
+		w.Write(data)
+	} else {
+		w.Write([]byte("error."))
+	}
+}
+
+type serverServices struct {
+	Port     int                   `json:"port"`
+	Services []mserver.ServiceInfo `json:"services"`
+}
+
+// getServicesHandler returns the services and methods exported by agent
+func (a *Agent) getServicesHandler(w http.ResponseWriter, r *http.Request) {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	servers := make([]serverServices, 0, len(a.agentPortServer))
+	for port, server := range a.agentPortServer {
+		servers = append(servers, serverServices{Port: port, Services: mserver.GetServices(server.GetMessageHandler())})
+	}
+	if data, err := json.Marshal(servers); err == nil {
+		w.Write(data)
+	} else {
+		w.Write([]byte("error."))
+	}
+}
+
+type serverConnections struct {
+	Port        int                      `json:"port"`
+	Connections []mserver.ConnectionInfo `json:"connections"`
+}
+
+// return current connections of agent server and server agents
+func (a *Agent) getConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	servers := make([]serverConnections, 0, len(a.agentPortServer)+1)
+	if ms, ok := a.agentServer.(*mserver.MotanServer); ok {
+		servers = append(servers, serverConnections{Port: a.port, Connections: ms.GetConnections()})
+	}
+	for port, server := range a.agentPortServer {
+		if ms, ok := server.(*mserver.MotanServer); ok {
+			servers = append(servers, serverConnections{Port: port, Connections: ms.GetConnections()})
+		}
+	}
+	if data, err := json.Marshal(servers); err == nil {
+		w.Write(data)
+	} else {
+		w.Write([]byte("error."))
+	}
+}
+
 // StatusChangeHandler change agent server status, and set registed services available or unavailable.
 func (a *Agent) StatusChangeHandler(w http.ResponseWriter, r *http.Request) {
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
 	switch r.RequestURI {
 	case "/200":
 		availableService(a.serviceRegistries)
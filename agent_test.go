@@ -0,0 +1,178 @@
+package motan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/provider"
+	"github.com/weibocom/motan-go/registry"
+	mserver "github.com/weibocom/motan-go/server"
+)
+
+// memoryZkConn is an in-memory zookeeper tree without watches
+type memoryZkConn struct {
+	lock  sync.Mutex
+	nodes map[string][]byte
+}
+
+func newMemoryZkConn() *memoryZkConn {
+	return &memoryZkConn{nodes: map[string][]byte{"": nil}}
+}
+
+func (m *memoryZkConn) Exists(path string) (bool, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.nodes[path]
+	return ok, &zk.Stat{}, nil
+}
+
+func (m *memoryZkConn) Get(path string) ([]byte, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	data, ok := m.nodes[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+func (m *memoryZkConn) GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	data, stat, err := m.Get(path)
+	return data, stat, make(chan zk.Event), err
+}
+
+func (m *memoryZkConn) Children(path string) ([]string, *zk.Stat, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var children []string
+	for p := range m.nodes {
+		if strings.HasPrefix(p, path+"/") && !strings.Contains(p[len(path)+1:], "/") {
+			children = append(children, p[len(path)+1:])
+		}
+	}
+	return children, &zk.Stat{}, nil
+}
+
+func (m *memoryZkConn) ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, err := m.Children(path)
+	return children, stat, make(chan zk.Event), err
+}
+
+func (m *memoryZkConn) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.nodes[path]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if _, ok := m.nodes[path[:strings.LastIndex(path, "/")]]; !ok {
+		return "", zk.ErrNoNode
+	}
+	m.nodes[path] = data
+	return path, nil
+}
+
+func (m *memoryZkConn) Delete(path string, version int32) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.nodes, path)
+	return nil
+}
+
+func TestStatusChangeHandler(t *testing.T) {
+	conn := newMemoryZkConn()
+	zkRegistry := registry.NewZkRegistry(&motan.URL{Protocol: "zookeeper"}, conn)
+	url := &motan.URL{Protocol: "motan2", Host: "127.0.0.1", Port: 8100, Path: "com.test.Status", Group: "test-group",
+		Parameters: map[string]string{motan.NodeTypeKey: motan.NodeTypeService}}
+	zkRegistry.Register(url)
+	agent := newTestAgent(&motan.Context{})
+	agent.serviceRegistries["zk"] = zkRegistry
+
+	exists := func(nodeType string) bool {
+		ok, _, _ := conn.Exists(registry.ToNodePath(url, nodeType))
+		return ok
+	}
+	if !exists(registry.ZkNodetypeServer) {
+		t.Fatal("service should be registered")
+	}
+	agent.StatusChangeHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/503", nil))
+	if exists(registry.ZkNodetypeServer) || !exists(registry.ZkNodetypeUnavailableServer) || agent.status != http.StatusServiceUnavailable {
+		t.Fatal("registered services should be unavailable")
+	}
+	agent.StatusChangeHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/200", nil))
+	if !exists(registry.ZkNodetypeServer) || exists(registry.ZkNodetypeUnavailableServer) || agent.status != http.StatusOK {
+		t.Fatal("registered services should be available")
+	}
+	zkRegistry.UnRegister(url)
+	agent.StatusChangeHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/503", nil))
+	if exists(registry.ZkNodetypeServer) || exists(registry.ZkNodetypeUnavailableServer) {
+		t.Fatal("unregistered service should not be switched")
+	}
+}
+
+func TestAgentExportService(t *testing.T) {
+	agent := newTestAgent(&motan.Context{RegistryURLs: map[string]*motan.URL{"test-registry": {Protocol: "test", Host: "127.0.0.1", Port: 8002}}})
+	mserver.RegistDefaultServers(agent.extFactory)
+	provider.RegistDefaultProvider(agent.extFactory)
+	newURL := func(path string, params map[string]string) *motan.URL {
+		url := &motan.URL{Path: path, Group: "test-group", Parameters: map[string]string{
+			motan.ExportKey:   "motan2:0",
+			motan.ProviderKey: provider.Mock,
+		}}
+		for k, v := range params {
+			url.Parameters[k] = v
+		}
+		return url
+	}
+	services := func() []string {
+		var paths []string
+		for _, url := range agent.GetExportServices() {
+			paths = append(paths, url.Path)
+		}
+		return paths
+	}
+	withRegistry := map[string]string{motan.RegistryKey: "test-registry"}
+
+	// export fails without registry, and the provider and port are released
+	if err := agent.ExportService(newURL("com.test.A", nil)); err == nil {
+		t.Fatal("export without registry should fail")
+	}
+	if len(services()) != 0 || len(agent.agentPortServer) != 0 {
+		t.Fatalf("failed export should be rolled back. services:%v, servers:%d", services(), len(agent.agentPortServer))
+	}
+
+	for _, path := range []string{"com.test.B", "com.test.A"} {
+		if err := agent.ExportService(newURL(path, withRegistry)); err != nil {
+			t.Fatalf("export service fail. path:%s, err:%v", path, err)
+		}
+	}
+	if paths := services(); strings.Join(paths, ",") != "com.test.A,com.test.B" {
+		t.Fatalf("exported services should be listed by path. services:%v", paths)
+	}
+	if len(agent.agentPortServer) != 1 || len(agent.serviceRegistries) != 1 {
+		t.Fatalf("services should share the port and registry. servers:%d, registries:%d", len(agent.agentPortServer), len(agent.serviceRegistries))
+	}
+	if err := agent.ExportService(newURL("com.test.A", withRegistry)); err == nil {
+		t.Fatal("duplicate export should fail")
+	}
+
+	if err := agent.UnexportService("com.test.C"); err == nil {
+		t.Fatal("unexport of unknown service should fail")
+	}
+	if err := agent.UnexportService("com.test.A"); err != nil {
+		t.Fatalf("unexport service fail. err:%v", err)
+	}
+	if paths := services(); len(paths) != 1 || paths[0] != "com.test.B" || len(agent.serviceRegistries) != 1 {
+		t.Fatalf("registry should be kept while it is used. services:%v, registries:%d", paths, len(agent.serviceRegistries))
+	}
+	if err := agent.UnexportService("com.test.B"); err != nil {
+		t.Fatalf("unexport service fail. err:%v", err)
+	}
+	if len(services()) != 0 || len(agent.agentPortServer) != 0 || len(agent.serviceRegistries) != 0 {
+		t.Fatalf("port and registry should be released. servers:%d, registries:%d", len(agent.agentPortServer), len(agent.serviceRegistries))
+	}
+}
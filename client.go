@@ -1,9 +1,11 @@
 package motan
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"reflect"
 	"sync"
 
 	cluster "github.com/weibocom/motan-go/cluster"
@@ -14,6 +16,9 @@ import (
 var (
 	clientContextMap   = make(map[string]*MCContext, 8)
 	clientContextMutex sync.Mutex
+
+	referFactories    = make(map[string]func(c *Client) interface{})
+	referFactoryMutex sync.RWMutex
 )
 
 type MCContext struct {
@@ -53,6 +58,73 @@ func (c *Client) Go(method string, args []interface{}, reply interface{}, done c
 	return c.BaseGo(req, reply, done)
 }
 
+type attachmentsContextKey struct{}
+
+// WithAttachments returns a context with the request attachments for CallContext and GoContext.
+// the attachments are merged with the ones already in ctx.
+func WithAttachments(ctx context.Context, attachments map[string]string) context.Context {
+	merged := make(map[string]string, len(attachments))
+	if old, ok := ctx.Value(attachmentsContextKey{}).(map[string]string); ok {
+		for k, v := range old {
+			merged[k] = v
+		}
+	}
+	for k, v := range attachments {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, attachmentsContextKey{}, merged)
+}
+
+// CallContext calls method with the attachments in ctx, and returns ctx.Err() if ctx is done before the call returns.
+func (c *Client) CallContext(ctx context.Context, method string, args []interface{}, reply interface{}) error {
+	req := c.buildContextRequest(ctx, method, args)
+	if ctx.Done() == nil {
+		return c.BaseCall(req, reply)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// the call may finish after ctx is done, so it replies to a new value which is copied to reply on success
+	var result reflect.Value
+	if reply != nil {
+		result = reflect.New(reflect.TypeOf(reply).Elem())
+	}
+	done := make(chan error, 1)
+	go func() {
+		if result.IsValid() {
+			done <- c.BaseCall(req, result.Interface())
+		} else {
+			done <- c.BaseCall(req, nil)
+		}
+	}()
+	select {
+	case err := <-done:
+		if err == nil && result.IsValid() {
+			reflect.ValueOf(reply).Elem().Set(result.Elem())
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GoContext calls method asynchronously with the attachments in ctx. the caller should wait ctx.Done() along with done.
+func (c *Client) GoContext(ctx context.Context, method string, args []interface{}, reply interface{}, done chan *motan.AsyncResult) *motan.AsyncResult {
+	return c.BaseGo(c.buildContextRequest(ctx, method, args), reply, done)
+}
+
+func (c *Client) buildContextRequest(ctx context.Context, method string, args []interface{}) motan.Request {
+	req := c.BuildRequest(method, args)
+	if attachments, ok := ctx.Value(attachmentsContextKey{}).(map[string]string); ok {
+		for k, v := range attachments {
+			if req.GetAttachment(k) == "" { // routing attachments of client are kept
+				req.SetAttachment(k, v)
+			}
+		}
+	}
+	return req
+}
+
 func (c *Client) BaseGo(req motan.Request, reply interface{}, done chan *motan.AsyncResult) *motan.AsyncResult {
 	result := &motan.AsyncResult{}
 	if done == nil || cap(done) == 0 {
@@ -152,7 +224,25 @@ func (m *MCContext) GetClient(clientid string) *Client {
 	return m.clients[clientid]
 }
 
-func (m *MCContext) GetRefer(service string) interface{} {
-	// TODO 对client的封装，可以根据idl自动生成代码时支持
-	return nil
+// GetRefer returns the typed client of the client id, e.g. the client generated by motangen.
+// nil is returned if the client is not found or no refer factory is registered for the service path of the client.
+func (m *MCContext) GetRefer(clientid string) interface{} {
+	c := m.clients[clientid]
+	if c == nil {
+		return nil
+	}
+	referFactoryMutex.RLock()
+	factory := referFactories[c.url.Path]
+	referFactoryMutex.RUnlock()
+	if factory == nil {
+		return nil
+	}
+	return factory(c)
+}
+
+// RegisterReferFactory registers the factory to create typed client of the service path. it is used by generated code.
+func RegisterReferFactory(path string, factory func(c *Client) interface{}) {
+	referFactoryMutex.Lock()
+	defer referFactoryMutex.Unlock()
+	referFactories[path] = factory
 }
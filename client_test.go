@@ -0,0 +1,58 @@
+package motan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// clientTestEndpoint replies the uid attachment after the delay in attachment
+type clientTestEndpoint struct {
+	motan.TestEndPoint
+}
+
+func (c *clientTestEndpoint) Call(request motan.Request) motan.Response {
+	delay, _ := time.ParseDuration(request.GetAttachment("delay"))
+	time.Sleep(delay)
+	if reply, ok := request.GetRPCContext(true).Reply.(*string); ok {
+		*reply = request.GetAttachment("uid")
+	}
+	return &motan.MotanResponse{RequestID: request.GetRequestID()}
+}
+
+func TestClientCallContext(t *testing.T) {
+	url := &motan.URL{Protocol: "clientctx", Path: "com.test.Client", Group: "test-group", Parameters: map[string]string{motan.RegistryKey: "reg"}}
+	mctx := &motan.Context{RegistryURLs: map[string]*motan.URL{"reg": {Protocol: "gateway"}}}
+	agent := newTestAgent(mctx)
+	agent.extFactory.RegistExtRegistry("gateway", func(url *motan.URL) motan.Registry {
+		return &gatewayTestRegistry{motan.TestRegistry{URL: url}}
+	})
+	agent.extFactory.RegistExtEndpoint("clientctx", func(url *motan.URL) motan.EndPoint {
+		return &clientTestEndpoint{motan.TestEndPoint{URL: url}}
+	})
+	client := &Client{url: url, cluster: agent.newCluster(url, mctx), extFactory: agent.extFactory}
+
+	var reply string
+	ctx := WithAttachments(context.Background(), map[string]string{"uid": "123"})
+	if err := client.CallContext(ctx, "hello", nil, &reply); err != nil || reply != "123" {
+		t.Fatalf("call with context fail. reply:%s, err:%v", reply, err)
+	}
+
+	reply = ""
+	ctx = WithAttachments(ctx, map[string]string{"delay": "200ms"})
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.CallContext(ctx, "hello", nil, &reply); err != context.DeadlineExceeded {
+		t.Fatalf("call should return when context is done. err:%v", err)
+	}
+	if cost := time.Since(start); cost > 100*time.Millisecond {
+		t.Fatalf("call should not wait after deadline. cost:%v", cost)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if reply != "" {
+		t.Fatalf("reply should not be set after deadline. reply:%s", reply)
+	}
+}
@@ -0,0 +1,169 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// locality settings of refer url. the idc of endpoints is the 'idc' param of the urls from registry
+const (
+	LocalityPolicyKey    = "localityPolicy"
+	LocalityThresholdKey = "localityThreshold" // percent of available local endpoints under which requests spill over to other idcs
+	LocalIDCKey          = "localIdc"          // idc of the caller, default is the -idc flag
+)
+
+// locality policies
+const (
+	LocalityPreferLocal = "prefer-local" // use local endpoints if any of them is available
+	LocalityLocalOnly   = "local-only"   // only use local endpoints
+	LocalitySpillover   = "spillover"    // spill over requests to all endpoints in proportion when local availability drops below threshold
+)
+
+const (
+	defaultLocalityThreshold = 50
+	localityCheckInterval    = time.Second
+)
+
+// LocalityInfo is the current locality decision of a cluster
+type LocalityInfo struct {
+	Policy         string  `json:"policy"`
+	LocalIDC       string  `json:"localIdc"`
+	Total          int     `json:"total"`
+	Local          int     `json:"local"`
+	LocalAvailable int     `json:"localAvailable"`
+	SpillRatio     float64 `json:"spillRatio"` // ratio of requests routed to all endpoints instead of local endpoints
+}
+
+// localityLB selects endpoints from local idc or all idcs according to the locality policy.
+// both local and all endpoints are selected by the load balance of the refer.
+type localityLB struct {
+	policy    string
+	localIDC  string
+	threshold int64
+	localLb   motan.LoadBalance
+	allLb     motan.LoadBalance
+
+	lock       sync.RWMutex
+	local      []motan.EndPoint
+	total      int
+	spillBits  uint64 // float64 bits of spill ratio
+	lastUpdate int64  // unix nano of last spill ratio update
+}
+
+// newLocalityLB returns the locality load balance of the url, or the lb itself if locality is not enabled
+func newLocalityLB(url *motan.URL, newLb func() motan.LoadBalance) motan.LoadBalance {
+	policy := url.GetParam(LocalityPolicyKey, "")
+	localIDC := url.GetParam(LocalIDCKey, *motan.IDC)
+	if policy == "" {
+		return newLb()
+	}
+	if policy != LocalityPreferLocal && policy != LocalityLocalOnly && policy != LocalitySpillover {
+		vlog.Warningf("unknown locality policy %s, locality is disabled. url:%s\n", policy, url.GetIdentity())
+		return newLb()
+	}
+	if localIDC == "" {
+		vlog.Warningf("local idc is not set, locality is disabled. url:%s\n", url.GetIdentity())
+		return newLb()
+	}
+	return &localityLB{
+		policy:    policy,
+		localIDC:  localIDC,
+		threshold: url.GetPositiveIntValue(LocalityThresholdKey, defaultLocalityThreshold),
+		localLb:   newLb(),
+		allLb:     newLb(),
+	}
+}
+
+func (l *localityLB) OnRefresh(endpoints []motan.EndPoint) {
+	local := make([]motan.EndPoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.GetURL().GetParam(motan.IDCKey, "") == l.localIDC {
+			local = append(local, ep)
+		}
+	}
+	l.localLb.OnRefresh(local)
+	l.allLb.OnRefresh(endpoints)
+	l.lock.Lock()
+	l.local = local
+	l.total = len(endpoints)
+	l.lock.Unlock()
+	atomic.StoreInt64(&l.lastUpdate, 0)
+}
+
+func (l *localityLB) Select(request motan.Request) motan.EndPoint {
+	return l.choose().Select(request)
+}
+
+func (l *localityLB) SelectArray(request motan.Request) []motan.EndPoint {
+	return l.choose().SelectArray(request)
+}
+
+func (l *localityLB) SetWeight(weight string) {
+	l.localLb.SetWeight(weight)
+	l.allLb.SetWeight(weight)
+}
+
+func (l *localityLB) choose() motan.LoadBalance {
+	spill := l.spillRatio()
+	if spill <= 0 || (spill < 1 && rand.Float64() >= spill) {
+		return l.localLb
+	}
+	return l.allLb
+}
+
+// spillRatio returns the ratio of requests to all endpoints. the ratio is updated at most once per second.
+func (l *localityLB) spillRatio() float64 {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&l.lastUpdate)
+	if now-last < int64(localityCheckInterval) || !atomic.CompareAndSwapInt64(&l.lastUpdate, last, now) {
+		return math.Float64frombits(atomic.LoadUint64(&l.spillBits))
+	}
+	info := l.info()
+	atomic.StoreUint64(&l.spillBits, math.Float64bits(info.SpillRatio))
+	return info.SpillRatio
+}
+
+func (l *localityLB) info() *LocalityInfo {
+	l.lock.RLock()
+	info := &LocalityInfo{Policy: l.policy, LocalIDC: l.localIDC, Total: l.total, Local: len(l.local)}
+	for _, ep := range l.local {
+		if ep.IsAvailable() {
+			info.LocalAvailable++
+		}
+	}
+	l.lock.RUnlock()
+	switch l.policy {
+	case LocalityLocalOnly:
+		info.SpillRatio = 0
+	case LocalityPreferLocal:
+		if info.LocalAvailable == 0 {
+			info.SpillRatio = 1
+		}
+	case LocalitySpillover:
+		if info.LocalAvailable == 0 {
+			info.SpillRatio = 1
+		} else if available := int64(info.LocalAvailable * 100 / info.Local); available < l.threshold {
+			info.SpillRatio = 1 - float64(available)/float64(l.threshold)
+		}
+	}
+	return info
+}
+
+// GetLocality returns the locality decision of the cluster. nil is returned if locality is not enabled
+func (m *MotanCluster) GetLocality() *LocalityInfo {
+	m.paramsLock.RLock()
+	loadBalance := m.LoadBalance
+	m.paramsLock.RUnlock()
+	if l, ok := loadBalance.(*localityLB); ok {
+		info := l.info()
+		atomic.StoreUint64(&l.spillBits, math.Float64bits(info.SpillRatio))
+		return info
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/lb"
+)
+
+type idcEndPoint struct {
+	motan.TestEndPoint
+	available bool
+}
+
+func (e *idcEndPoint) IsAvailable() bool {
+	return e.available
+}
+
+func newIdcEndPoint(port int, idc string) *idcEndPoint {
+	return &idcEndPoint{TestEndPoint: motan.TestEndPoint{URL: &motan.URL{Host: "127.0.0.1", Port: port, Parameters: map[string]string{motan.IDCKey: idc}}}, available: true}
+}
+
+func TestLocalityLB(t *testing.T) {
+	url := &motan.URL{Parameters: map[string]string{LocalityPolicyKey: LocalitySpillover, LocalIDCKey: "idc1", LocalityThresholdKey: "50"}}
+	l, ok := newLocalityLB(url, func() motan.LoadBalance { return &lb.RoundrobinLB{} }).(*localityLB)
+	if !ok {
+		t.Fatal("locality lb should be created")
+	}
+	local := []*idcEndPoint{newIdcEndPoint(8001, "idc1"), newIdcEndPoint(8002, "idc1"), newIdcEndPoint(8003, "idc1"), newIdcEndPoint(8004, "idc1")}
+	remote := newIdcEndPoint(9001, "idc2")
+	l.OnRefresh([]motan.EndPoint{local[0], local[1], local[2], local[3], remote})
+	for i := 0; i < 20; i++ {
+		if ep := l.Select(&motan.MotanRequest{}); ep.GetURL().GetParam(motan.IDCKey, "") != "idc1" {
+			t.Fatalf("should select local endpoint. endpoint:%+v", ep.GetURL())
+		}
+	}
+	// 1 of 4 local endpoints is available, (50-25)/50 of requests spill over
+	local[0].available, local[1].available, local[2].available = false, false, false
+	if info := l.info(); info.LocalAvailable != 1 || info.SpillRatio != 0.5 {
+		t.Fatalf("locality info not correct. info:%+v", info)
+	}
+	local[3].available = false
+	if info := l.info(); info.SpillRatio != 1 {
+		t.Fatalf("all requests should spill over. info:%+v", info)
+	}
+
+	url.Parameters[LocalityPolicyKey] = LocalityLocalOnly
+	l = newLocalityLB(url, func() motan.LoadBalance { return &lb.RoundrobinLB{} }).(*localityLB)
+	l.OnRefresh([]motan.EndPoint{local[0], remote})
+	if ep := l.Select(&motan.MotanRequest{}); ep != nil {
+		t.Fatalf("local-only should not select remote endpoint. endpoint:%+v", ep.GetURL())
+	}
+
+	url.Parameters[LocalIDCKey] = ""
+	if _, ok := newLocalityLB(url, func() motan.LoadBalance { return &lb.RoundrobinLB{} }).(*localityLB); ok {
+		t.Fatal("locality should be disabled without local idc")
+	}
+}
@@ -3,13 +3,31 @@ package cluster
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
+	"github.com/weibocom/motan-go/metrics"
 )
 
+// endpoint protection settings of refer url
+const (
+	EndpointProtectRatioKey   = "endpointProtectRatio"   // percent. a notify removing more endpoints than the ratio is protected, 0 means no protection
+	EndpointProtectConfirmKey = "endpointProtectConfirm" // a protected notify is applied after it is received continuously for the times
+	EndpointProtectTimeoutKey = "endpointProtectTimeout" // a protected notify is applied after the timeout in millisecond
+)
+
+const (
+	defaultEndpointProtectConfirm = 3
+	defaultEndpointProtectTimeout = 30000
+)
+
+// endpoints replaced by UpdateParams are destroyed after the delay, so the requests in flight can finish
+var endpointDestroyDelay = 10 * time.Second // replaced in tests
+
 type MotanCluster struct {
 	Context        *motan.Context
 	url            *motan.URL
@@ -21,10 +39,16 @@ type MotanCluster struct {
 	clusterFilter  motan.ClusterFilter
 	extFactory     motan.ExtentionFactory
 	registryRefers map[string][]motan.EndPoint
+	nodeURLs       map[string]*motan.URL // notified urls of endpoints by identity
+	weight         string
+	protections    map[string]*notifyProtection
 	notifyLock     sync.Mutex
 	available      bool
 	closed         bool
 	proxy          bool
+
+	// guards url, context, ha, lb, filters and refers which are replaced together by UpdateParams
+	paramsLock sync.RWMutex
 }
 
 func (m *MotanCluster) IsAvailable() bool {
@@ -41,25 +65,36 @@ func (m *MotanCluster) GetName() string {
 }
 
 func (m *MotanCluster) GetURL() *motan.URL {
+	m.paramsLock.RLock()
+	defer m.paramsLock.RUnlock()
 	return m.url
 }
 
 func (m *MotanCluster) SetURL(url *motan.URL) {
+	m.paramsLock.Lock()
 	m.url = url
+	m.paramsLock.Unlock()
 }
 func (m *MotanCluster) Call(request motan.Request) motan.Response {
 	if m.available {
-		return m.clusterFilter.Filter(m.HaStrategy, m.LoadBalance, request)
+		m.paramsLock.RLock()
+		clusterFilter, haStrategy, loadBalance := m.clusterFilter, m.HaStrategy, m.LoadBalance
+		m.paramsLock.RUnlock()
+		return clusterFilter.Filter(haStrategy, loadBalance, request)
 	}
 	vlog.Infoln("cluster:" + m.GetIdentity() + "is not available!")
 	return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "service cluster not available. maybe caused by degrade.", ErrType: motan.ServiceException})
 }
 func (m *MotanCluster) InitCluster() bool {
 	m.registryRefers = make(map[string][]motan.EndPoint)
+	m.nodeURLs = make(map[string]*motan.URL)
+	m.protections = make(map[string]*notifyProtection)
 	//ha
 	m.HaStrategy = m.extFactory.GetHa(m.url)
 	//lb
-	m.LoadBalance = m.extFactory.GetLB(m.url)
+	m.LoadBalance = newLocalityLB(m.url, func() motan.LoadBalance {
+		return m.extFactory.GetLB(m.url)
+	})
 	//filter
 	m.initFilters()
 	// parse registry and subscribe
@@ -79,12 +114,18 @@ func (m *MotanCluster) InitCluster() bool {
 	return true
 }
 func (m *MotanCluster) SetLoadBalance(loadBalance motan.LoadBalance) {
+	m.paramsLock.Lock()
 	m.LoadBalance = loadBalance
+	m.paramsLock.Unlock()
 }
 func (m *MotanCluster) SetHaStrategy(haStrategy motan.HaStrategy) {
+	m.paramsLock.Lock()
 	m.HaStrategy = haStrategy
+	m.paramsLock.Unlock()
 }
 func (m *MotanCluster) GetRefers() []motan.EndPoint {
+	m.paramsLock.RLock()
+	defer m.paramsLock.RUnlock()
 	return m.Refers
 }
 func (m *MotanCluster) refresh() {
@@ -94,18 +135,29 @@ func (m *MotanCluster) refresh() {
 			newRefers = append(newRefers, e)
 		}
 	}
+	m.paramsLock.Lock()
 	m.Refers = newRefers
+	m.paramsLock.Unlock()
 	m.LoadBalance.OnRefresh(newRefers)
 }
 func (m *MotanCluster) AddRegistry(registry motan.Registry) {
 	m.Registrys = append(m.Registrys, registry)
 }
 func (m *MotanCluster) Notify(registryURL *motan.URL, urls []*motan.URL) {
+	m.notify(registryURL, urls, false)
+}
+
+// notify refresh the endpoints of the registry. if force is false, a notify removing too many endpoints is protected
+func (m *MotanCluster) notify(registryURL *motan.URL, urls []*motan.URL, force bool) {
 	vlog.Infof("cluster %s receive notify size %d. \n", m.GetIdentity(), len(urls))
 	m.notifyLock.Lock()
 	defer m.notifyLock.Unlock()
+	if m.closed {
+		return
+	}
 	// process weight if has
 	urls = processWeight(m, urls)
+	urls = m.subset(urls)
 	endpoints := make([]motan.EndPoint, 0, len(urls))
 	endpointMap := make(map[string]motan.EndPoint)
 	if eps, ok := m.registryRefers[registryURL.GetIdentity()]; ok {
@@ -128,29 +180,24 @@ func (m *MotanCluster) Notify(registryURL *motan.URL, urls []*motan.URL) {
 		if tempEp, ok := endpointMap[u.GetIdentity()]; ok {
 			ep = tempEp
 			delete(endpointMap, u.GetIdentity())
+			ep = updateNodeWeight(ep, u)
 		}
 		if ep == nil {
-			newURL := u.Copy()
-			newURL.MergeParams(m.url.Parameters)
-			ep = m.extFactory.GetEndPoint(newURL)
-
-			if ep != nil {
-				ep.SetProxy(m.proxy)
-				serialization := motan.GetSerialization(newURL, m.extFactory)
-				if serialization == nil {
-					vlog.Warningf("MotanCluster can not find Serialization in DefaultExtentionFactory! url:%+v\n", m.url)
-				} else {
-					ep.SetSerialization(serialization)
-				}
-				motan.Initialize(ep)
-				ep = m.addFilter(ep, m.Filters)
-			}
+			ep = m.newEndpoint(u, m.url, m.Filters, m.Context)
 		}
 
 		if ep != nil {
 			endpoints = append(endpoints, ep)
+			m.nodeURLs[u.GetIdentity()] = u
 		}
 	}
+	if !force && m.protect(registryURL, urls, len(endpointMap)) {
+		// keep the endpoints to remove until the notify is confirmed
+		for _, ep := range endpointMap {
+			endpoints = append(endpoints, ep)
+		}
+		endpointMap = nil
+	}
 	if len(endpoints) == 0 {
 		if len(m.registryRefers) > 1 {
 			delete(m.registryRefers, registryURL.GetIdentity())
@@ -163,11 +210,182 @@ func (m *MotanCluster) Notify(registryURL *motan.URL, urls []*motan.URL) {
 		m.registryRefers[registryURL.GetIdentity()] = endpoints
 	}
 	m.refresh()
-	for _, ep := range endpointMap {
+	for id, ep := range endpointMap {
+		delete(m.nodeURLs, id)
 		ep.Destroy()
 	}
 }
 
+// newEndpoint creates the endpoint of notified url with the params and filters of refer url
+func (m *MotanCluster) newEndpoint(u *motan.URL, referURL *motan.URL, filters []motan.Filter, context *motan.Context) motan.EndPoint {
+	newURL := u.Copy()
+	newURL.MergeParams(referURL.Parameters)
+	ep := m.extFactory.GetEndPoint(newURL)
+	if ep == nil {
+		return nil
+	}
+	ep.SetProxy(m.proxy)
+	serialization := motan.GetSerialization(newURL, m.extFactory)
+	if serialization == nil {
+		vlog.Warningf("MotanCluster can not find Serialization in DefaultExtentionFactory! url:%+v\n", referURL)
+	} else {
+		ep.SetSerialization(serialization)
+	}
+	motan.Initialize(ep)
+	return addFilter(ep, filters, context)
+}
+
+// UpdateParams applies the parameter changes of refer url without rebuilding the cluster. the group, path, protocol
+// and registries must not change. ha, lb, filters and endpoints are built from the new url, then replace the old ones
+// together. the replaced endpoints are destroyed after endpointDestroyDelay.
+func (m *MotanCluster) UpdateParams(url *motan.URL, context *motan.Context) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	if m.closed {
+		return
+	}
+	haStrategy := m.extFactory.GetHa(url)
+	loadBalance := newLocalityLB(url, func() motan.LoadBalance {
+		return m.extFactory.GetLB(url)
+	})
+	loadBalance.SetWeight(m.weight)
+	clusterFilter, filters := motan.GetURLFilters(url, m.extFactory)
+	if clusterFilter == nil {
+		clusterFilter = motan.GetLastClusterFilter()
+	}
+	if filters == nil {
+		filters = make([]motan.Filter, 0)
+	}
+	registryRefers := make(map[string][]motan.EndPoint, len(m.registryRefers))
+	refers := make([]motan.EndPoint, 0, len(m.Refers))
+	var replaced []motan.EndPoint
+	for id, eps := range m.registryRefers {
+		endpoints := make([]motan.EndPoint, 0, len(eps))
+		for _, ep := range eps {
+			if u := m.nodeURLs[ep.GetURL().GetIdentity()]; u != nil {
+				if newEp := m.newEndpoint(u, url, filters, context); newEp != nil {
+					endpoints = append(endpoints, newEp)
+					replaced = append(replaced, ep)
+					continue
+				}
+			}
+			endpoints = append(endpoints, ep)
+		}
+		registryRefers[id] = endpoints
+		refers = append(refers, endpoints...)
+	}
+	loadBalance.OnRefresh(refers)
+
+	m.paramsLock.Lock()
+	m.url, m.Context = url, context
+	m.HaStrategy, m.LoadBalance = haStrategy, loadBalance
+	m.clusterFilter, m.Filters = clusterFilter, filters
+	m.registryRefers, m.Refers = registryRefers, refers
+	m.paramsLock.Unlock()
+	if len(replaced) > 0 {
+		time.AfterFunc(endpointDestroyDelay, func() {
+			for _, ep := range replaced {
+				ep.Destroy()
+			}
+		})
+	}
+	vlog.Infof("cluster %s params updated. endpoints:%d\n", m.GetIdentity(), len(refers))
+}
+
+// notifyProtection is a protected notify waiting for confirmation
+type notifyProtection struct {
+	key   string // identities of the notified urls
+	count int
+	timer *time.Timer
+}
+
+// protect returns whether the notify should be protected. a notify is protected if it removes more endpoints than
+// the protection ratio, until the same notify is received for confirm times or the protection timeout.
+func (m *MotanCluster) protect(registryURL *motan.URL, urls []*motan.URL, removed int) bool {
+	ratio := m.url.GetIntValue(EndpointProtectRatioKey, 0)
+	oldSize := len(m.registryRefers[registryURL.GetIdentity()])
+	p := m.protections[registryURL.GetIdentity()]
+	if ratio <= 0 || oldSize == 0 || int64(removed)*100 <= ratio*int64(oldSize) {
+		if p != nil {
+			p.timer.Stop()
+			delete(m.protections, registryURL.GetIdentity())
+		}
+		return false
+	}
+	identities := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if u != nil {
+			identities = append(identities, u.GetIdentity())
+		}
+	}
+	sort.Strings(identities)
+	key := strings.Join(identities, ",")
+	if p != nil && p.key == key {
+		p.count++
+		if p.count >= int(m.url.GetPositiveIntValue(EndpointProtectConfirmKey, defaultEndpointProtectConfirm)) {
+			vlog.Warningf("cluster %s endpoint protection released by confirmation. registry:%s, removed:%d, endpoints:%d\n", m.GetIdentity(), registryURL.GetIdentity(), removed, oldSize)
+			p.timer.Stop()
+			delete(m.protections, registryURL.GetIdentity())
+			return false
+		}
+		return true
+	}
+	if p != nil {
+		p.timer.Stop()
+	}
+	timeout := time.Duration(m.url.GetPositiveIntValue(EndpointProtectTimeoutKey, defaultEndpointProtectTimeout)) * time.Millisecond
+	p = &notifyProtection{key: key, count: 1}
+	p.timer = time.AfterFunc(timeout, func() {
+		m.notifyLock.Lock()
+		current := m.protections[registryURL.GetIdentity()]
+		if current == p {
+			delete(m.protections, registryURL.GetIdentity())
+		}
+		m.notifyLock.Unlock()
+		if current == p {
+			vlog.Warningf("cluster %s endpoint protection released by timeout. registry:%s\n", m.GetIdentity(), registryURL.GetIdentity())
+			m.notify(registryURL, urls, true)
+		}
+	})
+	if m.protections == nil {
+		m.protections = make(map[string]*notifyProtection)
+	}
+	m.protections[registryURL.GetIdentity()] = p
+	vlog.Warningf("cluster %s endpoint protection triggered. registry:%s, removed:%d, endpoints:%d, ratio:%d%%\n", m.GetIdentity(), registryURL.GetIdentity(), removed, oldSize, ratio)
+	metrics.AddCounter(metricsKey(m.GetIdentity())+".endpoint_protect_count", 1)
+	return true
+}
+
+func metricsKey(identity string) string {
+	return "motan-cluster:" + strings.Map(func(r rune) rune {
+		if metrics.Charmap[r] {
+			return '_'
+		}
+		return r
+	}, identity)
+}
+
+// updateNodeWeight returns the endpoint with node weight of notified url, so the endpoint is not rebuilt.
+// the url of endpoint is never changed because it is read concurrently, a new filter endpoint with the url is
+// returned instead, which shares the caller and filters of the old one.
+func updateNodeWeight(ep motan.EndPoint, u *motan.URL) motan.EndPoint {
+	weight, ok := u.Parameters[motan.WeightKey]
+	if old, oldOk := ep.GetURL().Parameters[motan.WeightKey]; old == weight && ok == oldOk {
+		return ep
+	}
+	fep, isFilter := ep.(*motan.FilterEndPoint)
+	if !isFilter {
+		return ep
+	}
+	newURL := fep.URL.Copy()
+	if ok {
+		newURL.Parameters[motan.WeightKey] = weight
+	} else {
+		delete(newURL.Parameters, motan.WeightKey)
+	}
+	return &motan.FilterEndPoint{URL: newURL, Filter: fep.Filter, StatusFilters: fep.StatusFilters, Caller: fep.Caller}
+}
+
 // remove rule protocol && set weight
 func processWeight(m *MotanCluster, urls []*motan.URL) []*motan.URL {
 	weight := ""
@@ -176,18 +394,19 @@ func processWeight(m *MotanCluster, urls []*motan.URL) []*motan.URL {
 		weight = url.Parameters["weight"]
 		urls = urls[:len(urls)-1]
 	}
+	m.weight = weight
 	m.LoadBalance.SetWeight(weight)
 	return urls
 }
 
-func (m *MotanCluster) addFilter(ep motan.EndPoint, filters []motan.Filter) motan.EndPoint {
+func addFilter(ep motan.EndPoint, filters []motan.Filter, context *motan.Context) motan.EndPoint {
 	fep := &motan.FilterEndPoint{URL: ep.GetURL(), Caller: ep}
 	statusFilters := make([]motan.Status, 0, len(filters))
 	var lastf motan.EndPointFilter
 	lastf = motan.GetLastEndPointFilter()
 	for _, f := range filters {
 		if ef, ok := f.NewFilter(ep.GetURL()).(motan.EndPointFilter); ok {
-			motan.CanSetContext(ef, m.Context)
+			motan.CanSetContext(ef, context)
 			ef.SetNext(lastf)
 			lastf = ef
 			if sf, ok := ef.(motan.Status); ok {
@@ -200,7 +419,7 @@ func (m *MotanCluster) addFilter(ep motan.EndPoint, filters []motan.Filter) mota
 	return fep
 }
 func (m *MotanCluster) GetIdentity() string {
-	return m.url.GetIdentity()
+	return m.GetURL().GetIdentity()
 }
 func (m *MotanCluster) Destroy() {
 	if !m.closed {
@@ -215,6 +434,9 @@ func (m *MotanCluster) Destroy() {
 			vlog.Infof("destroy endpoint %s .\n", e.GetURL().GetIdentity())
 			e.Destroy()
 		}
+		for _, p := range m.protections {
+			p.timer.Stop()
+		}
 		m.closed = true
 	}
 }
@@ -2,7 +2,9 @@ package cluster
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	motan "github.com/weibocom/motan-go/core"
 
@@ -74,6 +76,137 @@ func TestNotify(t *testing.T) {
 
 }
 
+func TestNotifyProtection(t *testing.T) {
+	cluster := initCluster()
+	cluster.url.Parameters[EndpointProtectRatioKey] = "50"
+	cluster.url.Parameters[EndpointProtectConfirmKey] = "2"
+	cluster.url.Parameters[EndpointProtectTimeoutKey] = "50"
+	refreshed := make(chan int, 16)
+	cluster.url.Parameters[motan.Lbkey] = "refreshSignal"
+	cluster.extFactory.RegistExtLb("refreshSignal", func(url *motan.URL) motan.LoadBalance {
+		return &refreshSignalLB{refreshed: refreshed}
+	})
+	cluster.InitCluster()
+	urls := make([]*motan.URL, 0, 4)
+	for port := 8001; port <= 8004; port++ {
+		urls = append(urls, &motan.URL{Host: "127.0.0.1", Port: port, Protocol: "test"})
+	}
+	cluster.Notify(RegistryURL, urls)
+	// remove 1 of 4 endpoints is not protected
+	cluster.Notify(RegistryURL, urls[:3])
+	if size := refersSize(cluster); size != 3 {
+		t.Fatalf("notify under protection ratio should be applied. refers size:%d", size)
+	}
+	// remove 2 of 3 endpoints is protected until confirmed
+	cluster.Notify(RegistryURL, urls[:1])
+	if size := refersSize(cluster); size != 3 {
+		t.Fatalf("notify over protection ratio should be protected. refers size:%d", size)
+	}
+	cluster.Notify(RegistryURL, urls[:1])
+	if size := refersSize(cluster); size != 1 {
+		t.Fatalf("confirmed notify should be applied. refers size:%d", size)
+	}
+	// protected notify is applied after timeout
+	cluster.Notify(RegistryURL, urls)
+	cluster.Notify(RegistryURL, urls[3:])
+	if size := refersSize(cluster); size != 4 {
+		t.Fatalf("notify over protection ratio should be protected. refers size:%d", size)
+	}
+	timeout := time.After(time.Second)
+	for size := 0; size != 1; {
+		select {
+		case size = <-refreshed:
+		case <-timeout:
+			t.Fatalf("protected notify should be applied after timeout. refers size:%d", refersSize(cluster))
+		}
+	}
+	cluster.Destroy()
+}
+
+// refersSize reads the refers under notify lock, the protection timer refreshes them in another goroutine
+func refersSize(cluster *MotanCluster) int {
+	cluster.notifyLock.Lock()
+	defer cluster.notifyLock.Unlock()
+	return len(cluster.Refers)
+}
+
+func TestNotifyWeight(t *testing.T) {
+	cluster := initCluster()
+	cluster.InitCluster()
+	url := &motan.URL{Host: "127.0.0.1", Port: 8001, Protocol: "test", Parameters: map[string]string{motan.WeightKey: "1"}}
+	cluster.Notify(RegistryURL, []*motan.URL{url})
+	ep := cluster.Refers[0].(*motan.FilterEndPoint)
+	url = url.Copy()
+	url.Parameters[motan.WeightKey] = "5"
+	cluster.Notify(RegistryURL, []*motan.URL{url})
+	if cluster.Refers[0].(*motan.FilterEndPoint).Caller != ep.Caller {
+		t.Fatalf("endpoint should not be rebuilt when weight changes")
+	}
+	if w := cluster.Refers[0].GetURL().GetParam(motan.WeightKey, ""); w != "5" {
+		t.Fatalf("endpoint weight should be updated. weight:%s", w)
+	}
+	if w := ep.GetURL().GetParam(motan.WeightKey, ""); w != "1" {
+		t.Fatalf("url of endpoint in use should not be changed. weight:%s", w)
+	}
+}
+
+func TestUpdateParams(t *testing.T) {
+	oldDelay := endpointDestroyDelay
+	endpointDestroyDelay = 50 * time.Millisecond
+	defer func() { endpointDestroyDelay = oldDelay }()
+	cluster := initCluster()
+	cluster.extFactory.RegistExtEndpoint("test", func(url *motan.URL) motan.EndPoint {
+		return &destroyRecordEndPoint{TestEndPoint: motan.TestEndPoint{URL: url}}
+	})
+	cluster.InitCluster()
+	urls := []*motan.URL{{Host: "127.0.0.1", Port: 8001, Protocol: "test"}, {Host: "127.0.0.1", Port: 8002, Protocol: "test"}}
+	cluster.Notify(RegistryURL, urls)
+	oldRefers := cluster.GetRefers()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if res := cluster.Call(&motan.MotanRequest{Method: "test", Attachment: make(map[string]string)}); res.GetException() != nil {
+				t.Errorf("call during params update fail. exception:%+v", res.GetException())
+				return
+			}
+		}
+	}()
+	url := cluster.GetURL().Copy()
+	url.Parameters[motan.TimeOutKey] = "300"
+	cluster.UpdateParams(url, cluster.Context)
+	close(stop)
+	<-done
+	for _, ep := range oldRefers {
+		if ep.(*motan.FilterEndPoint).Caller.(*destroyRecordEndPoint).isDestroyed() {
+			t.Fatal("replaced endpoint should not be destroyed before the delay")
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, ep := range oldRefers {
+		if !ep.(*motan.FilterEndPoint).Caller.(*destroyRecordEndPoint).isDestroyed() {
+			t.Fatal("replaced endpoint should be destroyed after the delay")
+		}
+	}
+	if cluster.GetURL() != url {
+		t.Fatal("cluster url should be updated")
+	}
+	if len(cluster.Refers) != 2 {
+		t.Fatalf("endpoints should be kept after params update. refers size:%d", len(cluster.Refers))
+	}
+	for _, ep := range cluster.Refers {
+		if timeout := ep.GetURL().GetParam(motan.TimeOutKey, ""); timeout != "300" {
+			t.Fatalf("endpoint should use the updated params. timeout:%s", timeout)
+		}
+	}
+}
+
 func TestCall(t *testing.T) {
 	cluster := initCluster()
 	cluster.InitCluster()
@@ -147,3 +280,28 @@ func getCustomExt() motan.ExtentionFactory {
 	})
 	return ext
 }
+
+// destroyRecordEndPoint records whether it is destroyed
+type destroyRecordEndPoint struct {
+	motan.TestEndPoint
+	destroyed int32
+}
+
+func (d *destroyRecordEndPoint) Destroy() {
+	atomic.StoreInt32(&d.destroyed, 1)
+}
+
+func (d *destroyRecordEndPoint) isDestroyed() bool {
+	return atomic.LoadInt32(&d.destroyed) == 1
+}
+
+// refreshSignalLB sends the endpoint size of each refresh
+type refreshSignalLB struct {
+	motan.TestLoadBalance
+	refreshed chan int
+}
+
+func (r *refreshSignalLB) OnRefresh(endpoints []motan.EndPoint) {
+	r.TestLoadBalance.OnRefresh(endpoints)
+	r.refreshed <- len(endpoints)
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"sort"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// subsetting settings of refer url. if subsetSize is set, the cluster only creates endpoints for a subset of the
+// notified urls. the subset is selected by rendezvous hashing of the client id and node addresses, so the subset of
+// a client is deterministic, different clients spread over all nodes, and a node change only replaces one node of the subset.
+const (
+	SubsetSizeKey     = "subsetSize"
+	SubsetClientIDKey = "subsetClientId" // default is the local ip
+)
+
+// subset returns the subset of notified urls. urls are returned as is if subsetting is not enabled
+func (m *MotanCluster) subset(urls []*motan.URL) []*motan.URL {
+	size := int(m.url.GetIntValue(SubsetSizeKey, 0))
+	if size <= 0 || len(urls) <= size {
+		return urls
+	}
+	clientHash := motan.Hash64(m.url.GetParam(SubsetClientIDKey, motan.GetLocalIP()))
+	candidates := make([]*motan.URL, 0, len(urls))
+	scores := make(map[*motan.URL]uint64, len(urls))
+	for _, u := range urls {
+		if u != nil && u.CanServe(m.url) {
+			candidates = append(candidates, u)
+			scores[u] = motan.RendezvousScore(clientHash, motan.Hash64(u.GetAddressStr()))
+		}
+	}
+	if len(candidates) <= size {
+		return candidates
+	}
+	sort.Sort(rankedURLs{urls: candidates, scores: scores})
+	vlog.Infof("cluster %s use subset of %d in %d endpoints\n", m.GetIdentity(), size, len(candidates))
+	return candidates[:size]
+}
+
+// rankedURLs sorts urls by score desc
+type rankedURLs struct {
+	urls   []*motan.URL
+	scores map[*motan.URL]uint64
+}
+
+func (r rankedURLs) Len() int {
+	return len(r.urls)
+}
+func (r rankedURLs) Swap(i, j int) {
+	r.urls[i], r.urls[j] = r.urls[j], r.urls[i]
+}
+func (r rankedURLs) Less(i, j int) bool {
+	return r.scores[r.urls[i]] > r.scores[r.urls[j]]
+}
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+func TestSubset(t *testing.T) {
+	urls := make([]*motan.URL, 0, 10)
+	for port := 8001; port <= 8010; port++ {
+		urls = append(urls, &motan.URL{Host: "127.0.0.1", Port: port, Protocol: "test"})
+	}
+	newCluster := func(clientID string) *MotanCluster {
+		cluster := initCluster()
+		cluster.url.Parameters[SubsetSizeKey] = "3"
+		cluster.url.Parameters[SubsetClientIDKey] = clientID
+		return cluster
+	}
+	addresses := func(cluster *MotanCluster) map[string]bool {
+		m := make(map[string]bool)
+		for _, ep := range cluster.Refers {
+			m[ep.GetURL().GetAddressStr()] = true
+		}
+		return m
+	}
+
+	cluster := newCluster("client1")
+	cluster.InitCluster()
+	cluster.Notify(RegistryURL, urls)
+	subset := addresses(cluster)
+	if len(subset) != 3 {
+		t.Fatalf("subset size not correct. subset:%v", subset)
+	}
+	if s := newCluster("client1").subset(urls); len(s) != 3 || !subset[s[0].GetAddressStr()] || !subset[s[1].GetAddressStr()] || !subset[s[2].GetAddressStr()] {
+		t.Fatalf("subset of same client should be deterministic")
+	}
+
+	// removing a node out of subset does not change the subset
+	var outside []*motan.URL
+	removedOutside := false
+	for _, u := range urls {
+		if !subset[u.GetAddressStr()] && !removedOutside {
+			removedOutside = true
+			continue
+		}
+		outside = append(outside, u)
+	}
+	cluster.Notify(RegistryURL, outside)
+	if unchanged := addresses(cluster); !reflect.DeepEqual(unchanged, subset) {
+		t.Fatalf("subset should not change. old:%v, new:%v", subset, unchanged)
+	}
+
+	// removing a node in subset only replaces the node
+	var rest []*motan.URL
+	var removed string
+	for _, u := range urls {
+		if subset[u.GetAddressStr()] && removed == "" {
+			removed = u.GetAddressStr()
+			continue
+		}
+		rest = append(rest, u)
+	}
+	cluster.Notify(RegistryURL, rest)
+	changed := addresses(cluster)
+	if len(changed) != 3 || changed[removed] {
+		t.Fatalf("removed node should be replaced. subset:%v", changed)
+	}
+	same := 0
+	for a := range changed {
+		if subset[a] {
+			same++
+		}
+	}
+	if same != 2 {
+		t.Errorf("only the removed node should be replaced. old:%v, new:%v", subset, changed)
+	}
+
+	// subsets of clients spread over all nodes
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		for _, u := range newCluster("client" + strconv.Itoa(i)).subset(urls) {
+			counts[u.GetAddressStr()]++
+		}
+	}
+	for _, u := range urls {
+		if c := counts[u.GetAddressStr()]; c < 10 || c > 60 {
+			t.Errorf("subsets are not balanced. counts:%v", counts)
+			break
+		}
+	}
+}
@@ -10,6 +10,13 @@ const (
 	BizException
 )
 
+// exception code
+const (
+	// ServerBusyErrCode : the server rejected the request without processing it because of
+	// worker pool or service concurrency overflow, so the request can be retried on another node.
+	ServerBusyErrCode = 503
+)
+
 // filter type
 const (
 	// EndPointFilterType filter for endpoint
@@ -40,6 +47,7 @@ const (
 	GzipSizeKey       = "mingzSize"
 	HostKey           = "host"
 	RemoteIPKey       = "remoteIP"
+	IDCKey            = "idc"
 )
 
 // nodeType
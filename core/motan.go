@@ -216,6 +216,23 @@ type MessageHandler interface {
 	GetProvider(serviceName string) Provider
 }
 
+// ProviderLister : message handler which can list all providers in it
+type ProviderLister interface {
+	GetProviders() []Provider
+}
+
+// MethodDescriber : provider which can describe the methods of its service
+type MethodDescriber interface {
+	GetMethods() []MethodInfo
+}
+
+// MethodInfo : the signature of a service method
+type MethodInfo struct {
+	Name  string   `json:"name"`
+	Args  []string `json:"args"`
+	Reply string   `json:"reply,omitempty"`
+}
+
 // Serialization : Serialization
 type Serialization interface {
 	GetSerialNum() int
@@ -257,6 +274,11 @@ type SetContext interface {
 	SetContext(context *Context)
 }
 
+// SetExtFactory :SetExtFactory
+type SetExtFactory interface {
+	SetExtFactory(factory ExtentionFactory)
+}
+
 // Initialize : Initialize if implement Initializable
 func Initialize(s interface{}) {
 	if init, ok := s.(Initializable); ok {
@@ -271,6 +293,13 @@ func CanSetContext(s interface{}, context *Context) {
 	}
 }
 
+// CanSetExtFactory :CanSetExtFactory
+func CanSetExtFactory(s interface{}, factory ExtentionFactory) {
+	if sf, ok := s.(SetExtFactory); ok {
+		sf.SetExtFactory(factory)
+	}
+}
+
 //-------------models--------------
 
 // SnapshotConf is model for registry snapshot config.
@@ -484,6 +513,11 @@ func BuildExceptionResponse(requestid uint64, e *Exception) *MotanResponse {
 	return &MotanResponse{RequestID: requestid, Exception: e}
 }
 
+// IsServerBusy : the exception means request is rejected by server before processing
+func IsServerBusy(e *Exception) bool {
+	return e != nil && e.ErrType == ServiceException && e.ErrCode == ServerBusyErrCode
+}
+
 // extensions factory-func
 
 type DefaultFilterFunc func() Filter
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"hash/fnv"
 	"math/rand"
 	"net"
 	"strconv"
@@ -112,3 +113,22 @@ func GetReqInfo(request Request) string {
 	buffer.WriteString("}")
 	return buffer.String()
 }
+
+// Hash64 returns the 64-bit FNV-1a hash of s
+func Hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// RendezvousScore returns the rendezvous hashing score of a node for a key. the xor of hashes is spread by the
+// finalizer of murmur3, so the node ranks of different keys are independent.
+func RendezvousScore(keyHash uint64, nodeHash uint64) uint64 {
+	h := keyHash ^ nodeHash
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb53ca62e1a87
+	h ^= h >> 33
+	return h
+}
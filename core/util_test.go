@@ -59,3 +59,17 @@ func TestFisrtUpper(t *testing.T) {
 		t.Errorf("first upper fail. %s", ns)
 	}
 }
+
+func TestRendezvousScore(t *testing.T) {
+	if h := Hash64("a"); h != 0xaf63dc4c8601ec8c {
+		t.Errorf("fnv-1a hash not correct. hash:%x", h)
+	}
+	key := Hash64("key")
+	node1, node2 := Hash64("127.0.0.1:8001"), Hash64("127.0.0.1:8002")
+	if RendezvousScore(key, node1) != RendezvousScore(node1, key) {
+		t.Errorf("rendezvous score should be symmetric")
+	}
+	if diff := RendezvousScore(key, node1) ^ RendezvousScore(key, node2); diff>>32 == 0 {
+		t.Errorf("rendezvous score of similar nodes should be spread. diff:%x", diff)
+	}
+}
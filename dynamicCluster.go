@@ -0,0 +1,148 @@
+package motan
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cluster "github.com/weibocom/motan-go/cluster"
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+// agent url parameter keys for dynamic clusters.
+// if dynamicCluster is true, the agent creates a refer cluster on demand for requests whose cluster is not configured.
+// the refer url is built from the basic refer 'dynamicBasicRefer' with the group, path, version and protocol of the request.
+// dynamic clusters idle longer than dynamicClusterTTL(ms) are destroyed.
+const (
+	DynamicClusterKey    = "dynamicCluster"
+	DynamicBasicReferKey = "dynamicBasicRefer"
+	DynamicClusterTTLKey = "dynamicClusterTTL"
+	DynamicClusterMaxKey = "dynamicClusterMax" // max count of dynamic clusters, requests of new clusters fail when it is reached
+)
+
+const (
+	defaultDynamicClusterTTL    = 10 * time.Minute
+	defaultDynamicClusterMax    = 1000
+	minDynamicClusterGCInterval = time.Second
+)
+
+// dynamicClusters creates and garbage-collects the clusters of agent which are not configured in refers
+type dynamicClusters struct {
+	agent      *Agent
+	basicRefer *motan.URL     // guarded by createLock
+	context    *motan.Context // context of new clusters, guarded by createLock
+	ttl        time.Duration
+	max        int
+	createLock sync.Mutex
+	lastAccess map[string]*int64 // unix nano of last access, guarded by agent.clusterLock
+}
+
+func (a *Agent) initDynamicClusters() {
+	if enable, _ := strconv.ParseBool(a.agentURL.GetParam(DynamicClusterKey, "false")); !enable {
+		return
+	}
+	basicReferKey := a.agentURL.GetParam(DynamicBasicReferKey, "")
+	basicRefer := a.Context.BasicRefers[basicReferKey]
+	if basicRefer == nil {
+		vlog.Warningf("can not find basicRefer '%s' for dynamic cluster, dynamic cluster is disabled.\n", basicReferKey)
+		return
+	}
+	d := &dynamicClusters{
+		agent:      a,
+		basicRefer: basicRefer,
+		context:    a.Context,
+		ttl:        a.agentURL.GetTimeDuration(DynamicClusterTTLKey, time.Millisecond, defaultDynamicClusterTTL),
+		max:        int(a.agentURL.GetPositiveIntValue(DynamicClusterMaxKey, defaultDynamicClusterMax)),
+		lastAccess: make(map[string]*int64),
+	}
+	a.dynamicClusters = d
+	go d.gc()
+	vlog.Infof("dynamic cluster is enabled. basicRefer:%s, ttl:%v, max:%d\n", basicReferKey, d.ttl, d.max)
+}
+
+// getCluster returns the cluster of the request, a dynamic cluster is created if the cluster is not found
+func (d *dynamicClusters) getCluster(ck string, request motan.Request) *cluster.MotanCluster {
+	d.agent.clusterLock.RLock()
+	c := d.agent.clustermap[ck]
+	last := d.lastAccess[ck]
+	d.agent.clusterLock.RUnlock()
+	if c != nil {
+		if last != nil {
+			atomic.StoreInt64(last, time.Now().UnixNano())
+		}
+		return c
+	}
+	path := request.GetAttachment(mpro.MPath)
+	if path == "" {
+		return nil
+	}
+
+	d.createLock.Lock()
+	defer d.createLock.Unlock()
+	d.agent.clusterLock.RLock()
+	c = d.agent.clustermap[ck]
+	count := len(d.lastAccess)
+	d.agent.clusterLock.RUnlock()
+	if c != nil {
+		return c
+	}
+	if count >= d.max {
+		vlog.Warningf("dynamic cluster count reaches max %d, cluster %s is not created\n", d.max, ck)
+		return nil
+	}
+	url := d.basicRefer.Copy()
+	url.Path = path
+	url.Group = request.GetAttachment(mpro.MGroup)
+	if protocol := request.GetAttachment(mpro.MProxyProtocol); protocol != "" {
+		url.Protocol = protocol
+	}
+	if version := request.GetAttachment(mpro.MVersion); version != "" {
+		url.PutParam(motan.VersionKey, version)
+	}
+	c = d.agent.newCluster(url, d.context)
+	now := time.Now().UnixNano()
+	d.agent.clusterLock.Lock()
+	if configured := d.agent.clustermap[ck]; configured != nil { // added by config reload
+		d.agent.clusterLock.Unlock()
+		c.Destroy()
+		return configured
+	}
+	d.agent.clustermap[ck] = c
+	d.lastAccess[ck] = &now
+	d.agent.clusterLock.Unlock()
+	vlog.Infof("dynamic cluster created. cluster:%s, url:%s\n", ck, url.GetIdentity())
+	return c
+}
+
+// gc destroys the dynamic clusters idle longer than ttl
+func (d *dynamicClusters) gc() {
+	interval := d.ttl / 2
+	if interval < minDynamicClusterGCInterval {
+		interval = minDynamicClusterGCInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.removeIdle(time.Now().Add(-d.ttl).UnixNano())
+	}
+}
+
+func (d *dynamicClusters) removeIdle(deadline int64) {
+	var idle []*cluster.MotanCluster
+	d.agent.clusterLock.Lock()
+	for ck, last := range d.lastAccess {
+		if atomic.LoadInt64(last) < deadline {
+			idle = append(idle, d.agent.clustermap[ck])
+			delete(d.agent.clustermap, ck)
+			delete(d.lastAccess, ck)
+			vlog.Infof("dynamic cluster is idle over %v and will be destroyed. cluster:%s\n", d.ttl, ck)
+		}
+	}
+	d.agent.clusterLock.Unlock()
+	for _, c := range idle { // a request may just get the cluster before it is removed
+		time.AfterFunc(reloadDestroyDelay, c.Destroy)
+	}
+}
@@ -0,0 +1,59 @@
+package motan
+
+import (
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+func TestDynamicClusters(t *testing.T) {
+	context := &motan.Context{RegistryURLs: map[string]*motan.URL{"reg": {Protocol: "test"}}}
+	agent := newTestAgent(context)
+	agent.dynamicClusters = &dynamicClusters{
+		agent:      agent,
+		basicRefer: &motan.URL{Protocol: "motan2", Parameters: map[string]string{motan.RegistryKey: "reg"}},
+		context:    context,
+		ttl:        time.Minute,
+		max:        1,
+		lastAccess: make(map[string]*int64),
+	}
+	request := newDynamicRequest("com.test.Dynamic")
+	c, ck := agent.getCluster(request)
+	if c == nil {
+		t.Fatal("dynamic cluster should be created")
+	}
+	if url := c.GetURL(); url.Path != "com.test.Dynamic" || url.Group != "dynamic-group" || url.Protocol != "motan2" {
+		t.Fatalf("dynamic cluster url not correct. url:%+v", url)
+	}
+	if again, _ := agent.getCluster(request); again != c {
+		t.Fatal("dynamic cluster should be reused")
+	}
+	if other, _ := agent.getCluster(newDynamicRequest("com.test.Other")); other != nil {
+		t.Fatal("dynamic cluster should not be created over max")
+	}
+	if noPath, _ := agent.getCluster(&motan.MotanRequest{}); noPath != nil {
+		t.Fatal("dynamic cluster should not be created without path")
+	}
+
+	agent.dynamicClusters.removeIdle(time.Now().Add(-time.Minute).UnixNano())
+	if agent.getClusters()[ck] == nil {
+		t.Fatal("active dynamic cluster should not be removed")
+	}
+	agent.dynamicClusters.removeIdle(time.Now().Add(time.Minute).UnixNano())
+	if agent.getClusters()[ck] != nil || len(agent.dynamicClusters.lastAccess) != 0 {
+		t.Fatal("idle dynamic cluster should be removed")
+	}
+	if other, _ := agent.getCluster(newDynamicRequest("com.test.Other")); other == nil {
+		t.Fatal("dynamic cluster should be created after idle cluster is removed")
+	}
+}
+
+func newDynamicRequest(path string) motan.Request {
+	request := &motan.MotanRequest{ServiceName: path}
+	request.SetAttachment(mpro.MPath, path)
+	request.SetAttachment(mpro.MGroup, "dynamic-group")
+	request.SetAttachment(mpro.MProxyProtocol, "motan2")
+	return request
+}
@@ -0,0 +1,177 @@
+package motan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+// agent url parameter keys for http gateway.
+// the gateway listens on httpGatewayPort if it is set, otherwise it is served on the agent port under httpGatewayPrefix.
+// the gateway is disabled if neither key is set.
+const (
+	HTTPGatewayPortKey   = "httpGatewayPort"
+	HTTPGatewayPrefixKey = "httpGatewayPrefix"
+)
+
+// request query keys and header prefix for http gateway
+const (
+	gatewayVersionKey       = "version"
+	gatewayProtocolKey      = "protocol"
+	gatewayAttachmentPrefix = "X-Motan-"
+	gatewayDefaultProtocol  = "motan2"
+)
+
+// gatewayResponse is the json body returned by http gateway
+type gatewayResponse struct {
+	Result    interface{}      `json:"result,omitempty"`
+	Exception *motan.Exception `json:"exception,omitempty"`
+}
+
+// httpGateway converts http requests to motan requests and calls the refer clusters of agent.
+// the path is /{group}/{service}/{method} after prefix, and the body is a json array of arguments.
+// version and protocol of the refer can be set by query, and headers with prefix 'X-Motan-' are used as attachments.
+// header names are case insensitive and canonicalized by http server, so the attachment names are lower case,
+// e.g. header 'X-Motan-Uid' is attachment 'uid'.
+type httpGateway struct {
+	agent   *Agent
+	handler *agentMessageHandler
+	prefix  string
+}
+
+func newHTTPGateway(agent *Agent, prefix string) *httpGateway {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &httpGateway{agent: agent, handler: &agentMessageHandler{agent: agent}, prefix: prefix}
+}
+
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		writeGatewayError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, g.prefix) {
+		writeGatewayError(w, http.StatusNotFound, "path not found: "+r.URL.Path)
+		return
+	}
+	s := strings.Split(strings.TrimPrefix(r.URL.Path, g.prefix), "/")
+	if len(s) != 3 || s[0] == "" || s[1] == "" || s[2] == "" {
+		writeGatewayError(w, http.StatusNotFound, "path must be "+g.prefix+"{group}/{service}/{method}")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, "read body fail: "+err.Error())
+		return
+	}
+	args, err := parseGatewayArguments(body)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, "arguments must be a json array: "+err.Error())
+		return
+	}
+	request := &motan.MotanRequest{ServiceName: s[1], Method: s[2], Arguments: args, Attachment: make(map[string]string, 16)}
+	for k, v := range r.Header {
+		if len(k) > len(gatewayAttachmentPrefix) && strings.EqualFold(k[:len(gatewayAttachmentPrefix)], gatewayAttachmentPrefix) && len(v) > 0 {
+			request.Attachment[strings.ToLower(k[len(gatewayAttachmentPrefix):])] = v[0]
+		}
+	}
+	request.Attachment[mpro.MGroup] = s[0]
+	request.Attachment[mpro.MPath] = s[1]
+	request.Attachment[mpro.MMethod] = s[2]
+	if version := r.URL.Query().Get(gatewayVersionKey); version != "" {
+		request.Attachment[mpro.MVersion] = version
+	}
+	protocol := r.URL.Query().Get(gatewayProtocolKey)
+	if protocol == "" {
+		protocol = gatewayDefaultProtocol
+	}
+	request.Attachment[mpro.MProxyProtocol] = protocol
+
+	if c, ck := g.agent.getCluster(request); c == nil {
+		writeGatewayError(w, http.StatusNotFound, "cluster not found. cluster:"+ck)
+		return
+	}
+	res := g.handler.Call(request)
+	if res.GetException() != nil {
+		status := http.StatusInternalServerError
+		if motan.IsServerBusy(res.GetException()) {
+			status = http.StatusServiceUnavailable
+		}
+		writeGatewayResponse(w, status, &gatewayResponse{Exception: res.GetException()})
+		return
+	}
+	if err := res.ProcessDeserializable(nil); err != nil {
+		vlog.Warningf("http gateway deserialize response fail. service:%s, method:%s, err:%s\n", s[1], s[2], err.Error())
+		writeGatewayError(w, http.StatusInternalServerError, "deserialize response fail: "+err.Error())
+		return
+	}
+	result := res.GetValue()
+	if b, ok := result.([]byte); ok {
+		result = string(b)
+	}
+	writeGatewayResponse(w, http.StatusOK, &gatewayResponse{Result: result})
+}
+
+// parseGatewayArguments convert json arguments to the types supported by simple serialization.
+// string and object with string values are kept, other values are passed as json strings.
+func parseGatewayArguments(body []byte) ([]interface{}, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var raws []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &raws); err != nil {
+			return nil, err
+		}
+	} else {
+		raws = []json.RawMessage{body}
+	}
+	args := make([]interface{}, 0, len(raws))
+	for _, raw := range raws {
+		var str string
+		var m map[string]string
+		if string(raw) == "null" {
+			args = append(args, nil)
+		} else if json.Unmarshal(raw, &str) == nil {
+			args = append(args, str)
+		} else if json.Unmarshal(raw, &m) == nil {
+			args = append(args, m)
+		} else {
+			args = append(args, string(raw))
+		}
+	}
+	return args, nil
+}
+
+func writeGatewayError(w http.ResponseWriter, status int, msg string) {
+	writeGatewayResponse(w, status, &gatewayResponse{Exception: &motan.Exception{ErrCode: status, ErrMsg: msg, ErrType: motan.ServiceException}})
+}
+
+func writeGatewayResponse(w http.ResponseWriter, status int, res *gatewayResponse) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b = []byte(`{"exception":{"errcode":500,"errmsg":"marshal response fail","errtype":1}}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (a *Agent) startHTTPGateway(port int, prefix string) {
+	vlog.Infof("start listen http gateway port %d, prefix:%s\n", port, prefix)
+	err := http.ListenAndServe(":"+strconv.Itoa(port), newHTTPGateway(a, prefix))
+	if err != nil {
+		vlog.Warningf("start listen http gateway port fail! port:%d, err:%s\n", port, err.Error())
+	}
+}
@@ -0,0 +1,92 @@
+package motan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// gatewayTestRegistry discovers an endpoint of the refer
+type gatewayTestRegistry struct {
+	motan.TestRegistry
+}
+
+func (g *gatewayTestRegistry) Discover(url *motan.URL) []*motan.URL {
+	return []*motan.URL{{Protocol: url.Protocol, Host: "127.0.0.1", Port: 8002, Path: url.Path, Group: url.Group}}
+}
+
+// gatewayTestEndpoint replies the attachments and arguments of request
+type gatewayTestEndpoint struct {
+	motan.TestEndPoint
+}
+
+func (g *gatewayTestEndpoint) Call(request motan.Request) motan.Response {
+	return &motan.MotanResponse{RequestID: request.GetRequestID(), Value: map[string]interface{}{
+		"uid":    request.GetAttachment("uid"),
+		"method": request.GetMethod(),
+		"args":   request.GetArguments(),
+	}}
+}
+
+func TestHTTPGateway(t *testing.T) {
+	url := &motan.URL{Protocol: "gateway", Path: "com.test.Gateway", Group: "test-group", Parameters: map[string]string{motan.RegistryKey: "reg"}}
+	context := &motan.Context{RegistryURLs: map[string]*motan.URL{"reg": {Protocol: "gateway"}}}
+	agent := newTestAgent(context)
+	agent.extFactory.RegistExtRegistry("gateway", func(url *motan.URL) motan.Registry {
+		return &gatewayTestRegistry{motan.TestRegistry{URL: url}}
+	})
+	agent.extFactory.RegistExtEndpoint("gateway", func(url *motan.URL) motan.EndPoint {
+		return &gatewayTestEndpoint{motan.TestEndPoint{URL: url}}
+	})
+	agent.clustermap[getURLClusterKey(url)] = agent.newCluster(url, context)
+	server := httptest.NewServer(newHTTPGateway(agent, "/gateway"))
+	defer server.Close()
+
+	call := func(method, path, body string, header map[string]string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("create request fail. err:%v", err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("gateway request fail. err:%v", err)
+		}
+		defer res.Body.Close()
+		var result map[string]interface{}
+		if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Fatalf("gateway response is not json. err:%v", err)
+		}
+		return res.StatusCode, result
+	}
+
+	status, result := call(http.MethodPost, "/gateway/test-group/com.test.Gateway/hello?protocol=gateway", `["a", {"k": "v"}, 1]`, map[string]string{"x-motan-uid": "123"})
+	if status != http.StatusOK {
+		t.Fatalf("gateway call fail. status:%d, result:%v", status, result)
+	}
+	value, _ := result["result"].(map[string]interface{})
+	if value["uid"] != "123" || value["method"] != "hello" {
+		t.Fatalf("request should be routed with attachments. result:%v", result)
+	}
+	if b, _ := json.Marshal(value["args"]); string(b) != `["a",{"k":"v"},"1"]` {
+		t.Fatalf("arguments not correct. args:%s", b)
+	}
+
+	for _, path := range []string{"/other/test-group/com.test.Gateway/hello", "/gateway/test-group/com.test.Gateway", "/gateway/test-group/com.test.Unknown/hello?protocol=gateway"} {
+		if status, result = call(http.MethodPost, path, "", nil); status != http.StatusNotFound || result["exception"] == nil {
+			t.Errorf("gateway should return not found. path:%s, status:%d", path, status)
+		}
+	}
+	if status, _ = call(http.MethodPut, "/gateway/test-group/com.test.Gateway/hello", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("gateway should reject method. status:%d", status)
+	}
+	if status, _ = call(http.MethodPost, "/gateway/test-group/com.test.Gateway/hello?protocol=gateway", "[", nil); status != http.StatusBadRequest {
+		t.Errorf("gateway should reject invalid arguments. status:%d", status)
+	}
+}
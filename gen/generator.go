@@ -0,0 +1,399 @@
+// Package gen generates typed motan client stubs and server registration helpers from go interface definitions.
+// the parameters and reply of methods must be supported by simple serialization. protobuf definitions are not supported.
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// simpleTypes are the types supported by simple serialization, which is the default serialization of motan-go.
+// parameters and reply of other types are rejected, because they can not be encoded.
+var simpleTypes = map[string]bool{"string": true, "[]byte": true, "[]uint8": true, "map[string]string": true}
+
+// ServiceAnnotation is the comment prefix to set the service path of an interface, e.g. '// motan:service com.weibo.HelloService'.
+// the service path is '<package>.<interface>' if it is not set.
+const ServiceAnnotation = "motan:service"
+
+// Config is the config of generator
+type Config struct {
+	Package    string   // package of generated code, default is the package of source file
+	Interfaces []string // interfaces to generate, default is all exported interfaces in source file
+}
+
+type service struct {
+	Name      string // interface name
+	Path      string // motan service path
+	Methods   []*method
+	Implement bool // whether the client implements the interface
+}
+
+type method struct {
+	Name     string // go method name
+	Remote   string // method name in request
+	Params   []*param
+	Variadic bool
+	Reply    string // reply type, empty if method has no reply
+	HasError bool
+}
+
+type param struct {
+	Name    string
+	Type    string
+	Context bool // context parameter is not sent to server
+}
+
+// Generate parses go source and returns the generated code of interfaces
+func Generate(filename string, src []byte, config Config) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	pkg := config.Package
+	if pkg == "" {
+		pkg = file.Name.Name
+	}
+	wanted := make(map[string]bool, len(config.Interfaces))
+	for _, name := range config.Interfaces {
+		wanted[name] = true
+	}
+	var services []*service
+	usedTypes := &bytes.Buffer{}
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			it, ok := ts.Type.(*ast.InterfaceType)
+			if !ok || !ts.Name.IsExported() || (len(wanted) > 0 && !wanted[ts.Name.Name]) {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			s, err := parseService(src, fset, file.Name.Name, ts.Name.Name, doc, it)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range s.Methods {
+				for _, p := range m.Params {
+					usedTypes.WriteString(p.Type + " ")
+				}
+				usedTypes.WriteString(m.Reply + " ")
+			}
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		return nil, errors.New("no interface found in " + filename)
+	}
+
+	needErrors := false
+	for _, s := range services {
+		for _, m := range s.Methods {
+			needErrors = needErrors || m.HasError
+		}
+	}
+	std, imports := usedImports(file, usedTypes.String())
+	if needErrors {
+		std = append([]string{`"errors"`}, std...)
+	}
+	buf := &bytes.Buffer{}
+	err = codeTemplate.Execute(buf, map[string]interface{}{
+		"Package":    pkg,
+		"StdImports": std,
+		"Imports":    imports,
+		"Services":   services,
+	})
+	if err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code fail: %v\n%s", err, buf.String())
+	}
+	return code, nil
+}
+
+func parseService(src []byte, fset *token.FileSet, pkg string, name string, doc *ast.CommentGroup, it *ast.InterfaceType) (*service, error) {
+	s := &service{Name: name, Path: pkg + "." + name, Implement: true}
+	if doc != nil {
+		for _, c := range doc.List {
+			text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*"))
+			if strings.HasPrefix(text, ServiceAnnotation) {
+				s.Path = strings.TrimSpace(strings.TrimPrefix(text, ServiceAnnotation))
+			}
+		}
+	}
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("embedded interface is not supported. interface:%s", name)
+		}
+		m := &method{Name: field.Names[0].Name, Remote: lowerFirst(field.Names[0].Name)}
+		if ft.Params != nil {
+			for i, p := range ft.Params.List {
+				typ := source(src, fset, p.Type)
+				if ell, ok := p.Type.(*ast.Ellipsis); ok {
+					m.Variadic = true
+					typ = "..." + source(src, fset, ell.Elt)
+				}
+				names := p.Names
+				if len(names) == 0 {
+					names = []*ast.Ident{{Name: "_"}}
+				}
+				isContext := i == 0 && typ == "context.Context"
+				if !isContext && !simpleTypes[strings.TrimPrefix(typ, "...")] {
+					return nil, fmt.Errorf("parameter type %s is not supported by simple serialization. method:%s.%s", typ, name, m.Name)
+				}
+				for _, n := range names {
+					pn := n.Name
+					if pn == "_" || reservedNames[pn] {
+						pn = "arg" + strconv.Itoa(len(m.Params))
+					}
+					m.Params = append(m.Params, &param{Name: pn, Type: typ, Context: isContext})
+				}
+			}
+		}
+		var results []string
+		if ft.Results != nil {
+			for _, r := range ft.Results.List {
+				typ := source(src, fset, r.Type)
+				count := len(r.Names)
+				if count == 0 {
+					count = 1
+				}
+				for i := 0; i < count; i++ {
+					results = append(results, typ)
+				}
+			}
+		}
+		if len(results) > 0 && results[len(results)-1] == "error" {
+			m.HasError = true
+			results = results[:len(results)-1]
+		}
+		if len(results) > 1 {
+			return nil, fmt.Errorf("method with multiple reply values is not supported. method:%s.%s", name, m.Name)
+		}
+		if len(results) == 1 {
+			if !simpleTypes[results[0]] {
+				return nil, fmt.Errorf("reply type %s is not supported by simple serialization. method:%s.%s", results[0], name, m.Name)
+			}
+			m.Reply = results[0]
+		}
+		if !m.HasError {
+			s.Implement = false // client method must return error
+		}
+		s.Methods = append(s.Methods, m)
+	}
+	return s, nil
+}
+
+// reservedNames are the names used in generated methods, parameters with these names are renamed
+var reservedNames = map[string]bool{"c": true, "args": true, "reply": true, "err": true, "v": true, "done": true, "errors": true, "motan": true, "motancore": true}
+
+func source(src []byte, fset *token.FileSet, node ast.Node) string {
+	return string(src[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+}
+
+// usedImports returns the standard and other imports of source file which are used by the types
+func usedImports(file *ast.File, types string) (std []string, imports []string) {
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" || name == "." || name == "motan" || name == "motancore" {
+			continue
+		}
+		if strings.Contains(types, name+".") {
+			imp := spec.Path.Value
+			if spec.Name != nil {
+				imp = name + " " + imp
+			}
+			if strings.Contains(strings.Split(path, "/")[0], ".") {
+				imports = append(imports, imp)
+			} else {
+				std = append(std, imp)
+			}
+		}
+	}
+	return std, imports
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// Signature returns the parameters of method declaration
+func (m *method) Signature() string {
+	params := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+p.Type)
+	}
+	return strings.Join(params, ", ")
+}
+
+// AsyncSignature returns the parameters of async method declaration. the variadic parameter is declared as slice,
+// because reply and done channel are the last parameters of async method.
+func (m *method) AsyncSignature() string {
+	params := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		params = append(params, p.Name+" "+strings.Replace(p.Type, "...", "[]", 1))
+	}
+	return strings.Join(params, ", ")
+}
+
+// Results returns the results of client method, the error is always returned
+func (m *method) Results() string {
+	if m.Reply == "" {
+		return "error"
+	}
+	return "(" + m.Reply + ", error)"
+}
+
+// Args returns the expression of request arguments
+func (m *method) Args() string {
+	args := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		if !p.Context && !strings.HasPrefix(p.Type, "...") {
+			args = append(args, p.Name)
+		}
+	}
+	return "[]interface{}{" + strings.Join(args, ", ") + "}"
+}
+
+// ContextParam returns the context parameter name, empty if method has no context
+func (m *method) ContextParam() string {
+	if len(m.Params) > 0 && m.Params[0].Context {
+		return m.Params[0].Name
+	}
+	return ""
+}
+
+// Call returns the expression of client call. the call with context sends the attachments in context and
+// returns when context is done.
+func (m *method) Call(async bool) string {
+	reply := "nil"
+	if m.Reply != "" {
+		reply = "&reply"
+		if async {
+			reply = "reply"
+		}
+	}
+	fn, ctx := "Call", ""
+	if async {
+		fn = "Go"
+	}
+	if m.ContextParam() != "" {
+		fn += "Context"
+		ctx = m.ContextParam() + ", "
+	}
+	if async {
+		return "c.client." + fn + "(" + ctx + strconv.Quote(m.Remote) + ", args, " + reply + ", done)"
+	}
+	return "c.client." + fn + "(" + ctx + strconv.Quote(m.Remote) + ", args, " + reply + ")"
+}
+
+// VariadicParam returns the variadic parameter name, empty if method is not variadic
+func (m *method) VariadicParam() string {
+	if !m.Variadic {
+		return ""
+	}
+	return m.Params[len(m.Params)-1].Name
+}
+
+var codeTemplate = template.Must(template.New("motan").Parse(`// Code generated by motangen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .StdImports}}
+	{{.}}
+{{- end}}
+{{if .StdImports}}
+{{end -}}
+	motan "github.com/weibocom/motan-go"
+	motancore "github.com/weibocom/motan-go/core"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range $s := .Services}}
+// {{$s.Name}}Path is the motan service path of {{$s.Name}}
+const {{$s.Name}}Path = "{{$s.Path}}"
+
+func init() {
+	motan.RegisterReferFactory({{$s.Name}}Path, func(c *motan.Client) interface{} {
+		return New{{$s.Name}}Client(c)
+	})
+}
+
+// {{$s.Name}}Client is the typed motan client of {{$s.Name}}
+type {{$s.Name}}Client struct {
+	client *motan.Client
+}
+{{if $s.Implement}}
+var _ {{$s.Name}} = (*{{$s.Name}}Client)(nil)
+{{end}}
+// New{{$s.Name}}Client returns a typed client of {{$s.Name}}
+func New{{$s.Name}}Client(c *motan.Client) *{{$s.Name}}Client {
+	return &{{$s.Name}}Client{client: c}
+}
+{{range $m := $s.Methods}}
+// {{$m.Name}} calls method {{$m.Remote}} of {{$s.Name}}
+func (c *{{$s.Name}}Client) {{$m.Name}}({{$m.Signature}}) {{$m.Results}} {
+	args := {{$m.Args}}
+{{- if $m.VariadicParam}}
+	for _, v := range {{$m.VariadicParam}} {
+		args = append(args, v)
+	}
+{{- end}}
+{{- if $m.Reply}}
+	var reply {{$m.Reply}}
+	err := {{$m.Call false}}
+	return reply, err
+{{- else}}
+	return {{$m.Call false}}
+{{- end}}
+}
+
+// {{$m.Name}}Async calls method {{$m.Remote}} of {{$s.Name}} asynchronously
+func (c *{{$s.Name}}Client) {{$m.Name}}Async({{$m.AsyncSignature}}{{if $m.Params}}, {{end}}{{if $m.Reply}}reply *{{$m.Reply}}, {{end}}done chan *motancore.AsyncResult) *motancore.AsyncResult {
+	args := {{$m.Args}}
+{{- if $m.VariadicParam}}
+	for _, v := range {{$m.VariadicParam}} {
+		args = append(args, v)
+	}
+{{- end}}
+	return {{$m.Call true}}
+}
+{{end}}
+// Register{{$s.Name}} exports the implementation of {{$s.Name}} in server context. sid is the ref of the service config
+func Register{{$s.Name}}(ctx *motan.MSContext, s {{$s.Name}}, sid string) error {
+	return ctx.RegisterService(s, sid)
+}
+
+// Unimplemented{{$s.Name}} can be embedded in implementations of {{$s.Name}}, methods not implemented return error
+type Unimplemented{{$s.Name}} struct{}
+{{range $m := $s.Methods}}{{if $m.HasError}}
+func (Unimplemented{{$s.Name}}) {{$m.Name}}({{$m.Signature}}) {{$m.Results}} {
+	return {{if $m.Reply}}*new({{$m.Reply}}), {{end}}errors.New("method {{$m.Name}} of {{$s.Name}} is not implemented")
+}
+{{end}}{{end}}{{end}}`))
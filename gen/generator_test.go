@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSource = `package demo
+
+import (
+	"context"
+)
+
+// HelloService is a demo service
+// motan:service com.weibo.motan.demo.HelloService
+type HelloService interface {
+	Hello(ctx context.Context, name string) (string, error)
+	Join(sep string, values ...string) (string, error)
+	Ping() error
+	Tags(id string) map[string]string
+}
+`
+
+func TestGenerate(t *testing.T) {
+	code, err := Generate("demo.go", []byte(testSource), Config{})
+	if err != nil {
+		t.Fatalf("generate fail. err:%v", err)
+	}
+	s := string(code)
+	expects := []string{
+		"package demo",
+		`"context"`,
+		`const HelloServicePath = "com.weibo.motan.demo.HelloService"`,
+		"func (c *HelloServiceClient) Hello(ctx context.Context, name string) (string, error)",
+		`err := c.client.CallContext(ctx, "hello", args, &reply)`,
+		`return c.client.GoContext(ctx, "hello", args, reply, done)`,
+		`err := c.client.Call("join", args, &reply)`,
+		"args := []interface{}{name}",
+		"func (c *HelloServiceClient) JoinAsync(sep string, values []string, reply *string, done chan *motancore.AsyncResult) *motancore.AsyncResult",
+		"for _, v := range values {",
+		`return c.client.Call("ping", args, nil)`,
+		"func (c *HelloServiceClient) Tags(id string) (map[string]string, error)",
+		"func RegisterHelloService(ctx *motan.MSContext, s HelloService, sid string) error",
+		"func (UnimplementedHelloService) Ping() error",
+	}
+	for _, e := range expects {
+		if !strings.Contains(s, e) {
+			t.Fatalf("generated code should contain %q. code:\n%s", e, s)
+		}
+	}
+	// Tags has no error return, so the client can not implement the interface
+	if strings.Contains(s, "var _ HelloService") {
+		t.Fatalf("client should not implement interface. code:\n%s", s)
+	}
+
+	if _, err = Generate("demo.go", []byte(testSource), Config{Interfaces: []string{"Unknown"}}); err == nil {
+		t.Fatal("generate unknown interface should fail")
+	}
+	if _, err = Generate("demo.go", []byte("package demo\ntype S interface{ M() (int, string, error) }"), Config{}); err == nil {
+		t.Fatal("multiple reply values should fail")
+	}
+	if _, err = Generate("demo.go", []byte("package demo\ntype S interface{ M(id int) error }"), Config{}); err == nil {
+		t.Fatal("parameter not supported by simple serialization should fail")
+	}
+	if _, err = Generate("demo.go", []byte("package demo\nimport \"time\"\ntype S interface{ M() (time.Time, error) }"), Config{}); err == nil {
+		t.Fatal("reply not supported by simple serialization should fail")
+	}
+}
@@ -0,0 +1,57 @@
+// Command motangen generates typed motan clients and server registration helpers from go interfaces.
+//
+// usage:
+//
+//	motangen -i service.go [-o service_motan.go] [-package pkg] [-interfaces HelloService,UserService]
+//
+// it can be used with go generate, e.g. '//go:generate motangen -i $GOFILE'.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/weibocom/motan-go/gen"
+)
+
+var (
+	input      = flag.String("i", "", "go source file with service interfaces")
+	output     = flag.String("o", "", "output file, default is <input>_motan.go")
+	pkg        = flag.String("package", "", "package of generated code, default is the package of input file")
+	interfaces = flag.String("interfaces", "", "comma separated interfaces to generate, default is all exported interfaces")
+)
+
+func main() {
+	flag.Parse()
+	if *input == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, err := ioutil.ReadFile(*input)
+	if err != nil {
+		fail(err)
+	}
+	config := gen.Config{Package: *pkg}
+	if *interfaces != "" {
+		config.Interfaces = strings.Split(*interfaces, ",")
+	}
+	code, err := gen.Generate(*input, src, config)
+	if err != nil {
+		fail(err)
+	}
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(*input, ".go") + "_motan.go"
+	}
+	if err = ioutil.WriteFile(out, code, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "motangen: "+err.Error())
+	os.Exit(1)
+}
@@ -32,23 +32,46 @@ func (f *FailOverHA) Call(request motan.Request, loadBalance motan.LoadBalance)
 	}()
 	retries := f.url.GetMethodPositiveIntValue(request.GetMethod(), request.GetMethodDesc(), "retries", defaultRetries)
 	var lastErr *motan.Exception
-	for i := 0; i <= int(retries); i++ {
+	var busyEp motan.EndPoint
+	attempts, busyRetried := int(retries)+1, false
+	for i := 0; i < attempts; i++ {
 		ep := loadBalance.Select(request)
 		if ep == nil {
 			return getErrorResponse(request.GetRequestID(), fmt.Sprintf("No referers for request, RequestID: %d, Request info: %+v",
 				request.GetRequestID(), request.GetAttachments()))
 		}
+		if busyEp != nil && ep == busyEp {
+			ep = selectOther(request, loadBalance, busyEp)
+		}
 		respnose := ep.Call(request)
 		if respnose.GetException() == nil || respnose.GetException().ErrType == motan.BizException {
 			return respnose
 		}
 		lastErr = respnose.GetException()
+		busyEp = nil
+		if motan.IsServerBusy(lastErr) { // the request is not processed by server, retry on another node
+			busyEp = ep
+			if !busyRetried { // a busy rejection is retried once even if retries is 0
+				busyRetried = true
+				attempts++
+			}
+		}
 		vlog.Warningf("FailOverHA call fail! url:%s, err:%+v\n", ep.GetURL().GetIdentity(), lastErr)
 	}
 	return getErrorResponse(request.GetRequestID(), fmt.Sprintf("call fail over %d times.Exception:%s", retries, lastErr.ErrMsg))
 
 }
 
+// selectOther select an endpoint different from the exclude one if possible
+func selectOther(request motan.Request, loadBalance motan.LoadBalance, exclude motan.EndPoint) motan.EndPoint {
+	for _, ep := range loadBalance.SelectArray(request) {
+		if ep != exclude {
+			return ep
+		}
+	}
+	return exclude
+}
+
 func getErrorResponse(requestid uint64, errmsg string) *motan.MotanResponse {
 	return motan.BuildExceptionResponse(requestid, &motan.Exception{ErrCode: 400, ErrMsg: errmsg, ErrType: motan.ServiceException})
 }
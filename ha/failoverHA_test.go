@@ -22,3 +22,47 @@ func TestGetName(t *testing.T) {
 		t.Errorf("ha call fail. res:%+v", res)
 	}
 }
+
+// busyEndPoint rejects all requests as server busy
+type busyEndPoint struct {
+	motan.TestEndPoint
+	calls int
+}
+
+func (b *busyEndPoint) Call(request motan.Request) motan.Response {
+	b.calls++
+	return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: motan.ServerBusyErrCode, ErrMsg: "busy", ErrType: motan.ServiceException})
+}
+
+// fixedLoadBalance always selects the first endpoint
+type fixedLoadBalance struct {
+	motan.TestLoadBalance
+}
+
+func (f *fixedLoadBalance) Select(request motan.Request) motan.EndPoint {
+	return f.Endpoints[0]
+}
+
+func (f *fixedLoadBalance) SelectArray(request motan.Request) []motan.EndPoint {
+	return f.Endpoints
+}
+
+func TestFailOverServerBusy(t *testing.T) {
+	ha := &FailOverHA{url: &motan.URL{Protocol: "motan", Path: "test/path", Parameters: map[string]string{}}}
+	request := &motan.MotanRequest{ServiceName: "test", Method: "test", Attachment: map[string]string{}}
+	newBusy := func(port int) *busyEndPoint {
+		return &busyEndPoint{TestEndPoint: motan.TestEndPoint{URL: &motan.URL{Host: "127.0.0.1", Port: port}}}
+	}
+	busy := newBusy(8001)
+	lb := &fixedLoadBalance{}
+	lb.OnRefresh([]motan.EndPoint{busy, &motan.TestEndPoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8002}}})
+	if res := ha.Call(request, lb); res.GetException() != nil || busy.calls != 1 {
+		t.Fatalf("busy rejection should be retried on another endpoint. exception:%+v, busy calls:%d", res.GetException(), busy.calls)
+	}
+
+	busy, other := newBusy(8001), newBusy(8002)
+	lb.OnRefresh([]motan.EndPoint{busy, other})
+	if res := ha.Call(request, lb); res.GetException() == nil || busy.calls != 1 || other.calls != 1 {
+		t.Fatalf("busy rejection should be retried only once. exception:%+v, calls:%d,%d", res.GetException(), busy.calls, other.calls)
+	}
+}
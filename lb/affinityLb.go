@@ -0,0 +1,152 @@
+package lb
+
+import (
+	"sort"
+	"strings"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/metrics"
+)
+
+// affinity settings of refer url
+const (
+	AffinityKeyKey       = "affinityKey"       // request attachment to route by, e.g. uid
+	AffinityLoadBoundKey = "affinityLoadBound" // percent of average in-flight calls an endpoint can take before requests spill over
+	AffinityLoadFloorKey = "affinityLoadFloor" // in-flight calls an endpoint can always take, so the load bound does not apply at low load
+)
+
+const (
+	defaultAffinityLoadBound = 125
+	minAffinityLoadBound     = 101
+	defaultAffinityLoadFloor = 8
+)
+
+var addCounter = metrics.AddCounter // replaced in tests
+
+// AffinityLB routes requests with the same affinity attachment to the same endpoint by rendezvous hashing.
+// an endpoint is skipped if it is unavailable or its in-flight calls exceed the load bound, then the request goes to
+// the endpoint with the next highest score, so only the keys of that endpoint move. requests routed away from their
+// preferred endpoint are counted as affinity misses. requests without the attachment are selected at random.
+type AffinityLB struct {
+	url       *motan.URL
+	endpoints []motan.EndPoint
+	hashes    []uint64 // hash of endpoint addresses
+	weight    string
+}
+
+func (a *AffinityLB) OnRefresh(endpoints []motan.EndPoint) {
+	eps := rewrapEndpoints(a.endpoints, endpoints, func(ep motan.EndPoint) wrappedEndpoint {
+		return &activeEndpoint{EndPoint: ep}
+	})
+	hashes := make([]uint64, len(eps))
+	for i, ep := range eps {
+		hashes[i] = motan.Hash64(ep.GetURL().GetAddressStr())
+	}
+	a.hashes = hashes
+	a.endpoints = eps
+}
+
+func (a *AffinityLB) Select(request motan.Request) motan.EndPoint {
+	eps := a.affinitySelect(request, a.endpoints, a.hashes, 1)
+	if len(eps) == 0 {
+		return nil
+	}
+	return eps[0]
+}
+
+func (a *AffinityLB) SelectArray(request motan.Request) []motan.EndPoint {
+	return a.affinitySelect(request, a.endpoints, a.hashes, MaxSelectArraySize)
+}
+
+func (a *AffinityLB) SetWeight(weight string) {
+	a.weight = weight
+}
+
+// affinitySelect returns at most n endpoints in order of rendezvous score, the first one is within load bound if any
+func (a *AffinityLB) affinitySelect(request motan.Request, eps []motan.EndPoint, hashes []uint64, n int) []motan.EndPoint {
+	var key string
+	if request != nil {
+		key = request.GetAttachment(a.url.GetParam(AffinityKeyKey, ""))
+	}
+	if key == "" || len(hashes) != len(eps) {
+		index, endpoint := SelectOneAtRandom(eps)
+		if endpoint == nil {
+			return nil
+		}
+		if n == 1 {
+			return []motan.EndPoint{endpoint}
+		}
+		return SelectArrayFromIndex(eps, index)
+	}
+	keyHash := motan.Hash64(key)
+	ranked := make([]int, len(eps))
+	scores := make([]uint64, len(eps))
+	var totalActive int64
+	for i := range eps {
+		ranked[i] = i
+		scores[i] = motan.RendezvousScore(keyHash, hashes[i])
+		totalActive += eps[i].(*activeEndpoint).getActive()
+	}
+	sort.Sort(rankedEndpoints{indexes: ranked, scores: scores})
+	loadBound := a.url.GetPositiveIntValue(AffinityLoadBoundKey, defaultAffinityLoadBound)
+	if loadBound < minAffinityLoadBound {
+		loadBound = minAffinityLoadBound
+	}
+	// an endpoint is overloaded if its in-flight calls reach max(ceil(loadBound% * (total + 1) / endpoints), loadFloor)
+	capacity := int64(100 * len(eps))
+	bound := ((totalActive+1)*loadBound + capacity - 1) / capacity
+	if floor := a.url.GetPositiveIntValue(AffinityLoadFloorKey, defaultAffinityLoadFloor); bound < floor {
+		bound = floor
+	}
+	result := make([]motan.EndPoint, 0, n)
+	var overloaded []motan.EndPoint
+	for _, i := range ranked {
+		if len(result) >= n {
+			break
+		}
+		if ep := eps[i]; ep.IsAvailable() {
+			if len(result) == 0 && ep.(*activeEndpoint).getActive() >= bound {
+				overloaded = append(overloaded, ep)
+				continue
+			}
+			result = append(result, ep)
+		}
+	}
+	if len(result) == 0 { // all available endpoints are overloaded
+		result = overloaded
+	} else if len(overloaded) > 0 {
+		result = append(result[:1], append(overloaded, result[1:]...)...)
+	}
+	if len(result) > n {
+		result = result[:n]
+	}
+	if len(result) > 0 && result[0] != eps[ranked[0]] {
+		addCounter(a.metricsKey()+".affinity_miss_count", 1)
+	}
+	return result
+}
+
+func (a *AffinityLB) metricsKey() string {
+	return "motan-lb:" + strings.Map(func(r rune) rune {
+		if metrics.Charmap[r] {
+			return '_'
+		}
+		return r
+	}, a.url.Group+":"+a.url.Path)
+}
+
+// rankedEndpoints sorts endpoint indexes by score desc
+type rankedEndpoints struct {
+	indexes []int
+	scores  []uint64
+}
+
+func (r rankedEndpoints) Len() int {
+	return len(r.indexes)
+}
+func (r rankedEndpoints) Swap(i, j int) {
+	r.indexes[i], r.indexes[j] = r.indexes[j], r.indexes[i]
+}
+func (r rankedEndpoints) Less(i, j int) bool {
+	return r.scores[r.indexes[i]] > r.scores[r.indexes[j]]
+}
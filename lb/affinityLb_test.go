@@ -0,0 +1,88 @@
+package lb
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+	"github.com/weibocom/motan-go/metrics"
+)
+
+func TestAffinityLB(t *testing.T) {
+	lb := &AffinityLB{url: &motan.URL{Parameters: map[string]string{AffinityKeyKey: "uid"}}}
+	endpoints := make([]motan.EndPoint, 0, 5)
+	for i := 0; i < 5; i++ {
+		endpoints = append(endpoints, lbTestMockEndpoint{MockEndpoint: &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8001 + i}}, index: i, isAvail: true})
+	}
+	lb.OnRefresh(endpoints)
+	request := func(uid int) motan.Request {
+		return &motan.MotanRequest{Attachment: map[string]string{"uid": strconv.Itoa(uid)}}
+	}
+	selected := make(map[int]motan.EndPoint)
+	counts := make(map[motan.EndPoint]int)
+	for uid := 0; uid < 500; uid++ {
+		ep := lb.Select(request(uid))
+		if lb.Select(request(uid)) != ep {
+			t.Fatalf("same key should select same endpoint. uid:%d", uid)
+		}
+		selected[uid] = ep
+		counts[ep]++
+		if eps := lb.SelectArray(request(uid)); len(eps) != MaxSelectArraySize || eps[0] != ep {
+			t.Fatalf("select array should start with the affinity endpoint. eps:%v", eps)
+		}
+	}
+	if len(counts) != 5 {
+		t.Errorf("keys should be spread over endpoints. counts:%v", counts)
+	}
+
+	// keys of unavailable endpoint move, others stay
+	down := lb.endpoints[0].(*activeEndpoint)
+	replaced := append([]motan.EndPoint{}, endpoints...)
+	replaced[0] = lbTestMockEndpoint{MockEndpoint: endpoints[0].(lbTestMockEndpoint).MockEndpoint, index: 0, isAvail: false}
+	lb.OnRefresh(replaced)
+	for uid := 0; uid < 500; uid++ {
+		ep := lb.Select(request(uid))
+		if ep.(*activeEndpoint).unwrap() == replaced[0] {
+			t.Fatalf("unavailable endpoint should not be selected")
+		}
+		if selected[uid] != down && ep != selected[uid] {
+			t.Fatalf("key of available endpoint should not move. uid:%d", uid)
+		}
+	}
+
+	// overloaded endpoint spills over
+	lb.OnRefresh(endpoints)
+	preferred := lb.Select(request(1)).(*activeEndpoint)
+	preferred.active = 2
+	if ep := lb.Select(request(1)); ep != preferred {
+		t.Errorf("load bound should not apply under load floor")
+	}
+	var misses int64
+	addCounter = func(key string, value int64) {
+		if strings.HasSuffix(key, ".affinity_miss_count") {
+			misses += value
+		}
+	}
+	defer func() {
+		addCounter = metrics.AddCounter
+	}()
+	preferred.active = 10
+	if ep := lb.Select(request(1)); ep == preferred {
+		t.Errorf("overloaded endpoint should be skipped")
+	}
+	if misses != 1 {
+		t.Errorf("affinity miss should be counted. misses:%d", misses)
+	}
+	preferred.active = 0
+	if ep := lb.Select(request(1)); ep != preferred {
+		t.Errorf("affinity should be restored when load drops")
+	}
+	if misses != 1 {
+		t.Errorf("affinity hit should not be counted as miss. misses:%d", misses)
+	}
+	if ep := lb.Select(&motan.MotanRequest{}); ep == nil {
+		t.Errorf("request without affinity key should be selected at random")
+	}
+}
@@ -0,0 +1,174 @@
+package lb
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strconv"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// consistent hash settings of refer url.
+// the hash key is the request attachment named by hashKey. if hashKey is not set, the argument at index hashArg is used.
+// the argument of proxy request is the serialized body of all arguments, so hashArg should be 0 in agent.
+const (
+	HashKeyKey          = "hashKey"
+	HashArgKey          = "hashArg"
+	HashVirtualNodesKey = "hashVirtualNodes" // virtual nodes of each endpoint on the ring
+)
+
+const defaultHashVirtualNodes = 160
+
+// ConsistentHashLB selects endpoints on a ketama hash ring. each endpoint has virtual nodes on the ring according to
+// its address, so only the keys of added or removed endpoints are remapped when endpoints change.
+// requests without hash key are selected at random.
+type ConsistentHashLB struct {
+	url       *motan.URL
+	endpoints []motan.EndPoint
+	ring      *hashRing
+	weight    string
+}
+
+type hashRing struct {
+	points    []uint32
+	nodes     []int // endpoint index of points
+	endpoints []motan.EndPoint
+}
+
+func (c *ConsistentHashLB) OnRefresh(endpoints []motan.EndPoint) {
+	c.ring = newHashRing(endpoints, int(c.url.GetPositiveIntValue(HashVirtualNodesKey, defaultHashVirtualNodes)))
+	c.endpoints = endpoints
+}
+
+func (c *ConsistentHashLB) Select(request motan.Request) motan.EndPoint {
+	eps := c.ring.lookup(c.hashKey(request), 1)
+	if eps == nil {
+		_, ep := SelectOneAtRandom(c.endpoints)
+		return ep
+	}
+	if len(eps) == 0 {
+		return nil
+	}
+	return eps[0]
+}
+
+// SelectArray returns the distinct available endpoints following the hash key on the ring
+func (c *ConsistentHashLB) SelectArray(request motan.Request) []motan.EndPoint {
+	eps := c.ring.lookup(c.hashKey(request), MaxSelectArraySize)
+	if eps == nil {
+		index, endpoint := SelectOneAtRandom(c.endpoints)
+		if endpoint == nil {
+			return nil
+		}
+		return SelectArrayFromIndex(c.endpoints, index)
+	}
+	return eps
+}
+
+func (c *ConsistentHashLB) SetWeight(weight string) {
+	c.weight = weight
+}
+
+// hashKey returns the hash key of request, nil if the request has no key
+func (c *ConsistentHashLB) hashKey(request motan.Request) []byte {
+	if request == nil {
+		return nil
+	}
+	if key := c.url.GetParam(HashKeyKey, ""); key != "" {
+		if v := request.GetAttachment(key); v != "" {
+			return []byte(v)
+		}
+		return nil
+	}
+	args := request.GetArguments()
+	index := int(c.url.GetIntValue(HashArgKey, 0))
+	if index < 0 || index >= len(args) || args[index] == nil {
+		return nil
+	}
+	switch v := args[index].(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	case *motan.DeserializableValue:
+		return v.Body
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// newHashRing builds ketama ring, each md5 digest of '<address>-<n>' provides 4 points
+func newHashRing(endpoints []motan.EndPoint, virtualNodes int) *hashRing {
+	r := &hashRing{endpoints: endpoints}
+	points := make(ringPoints, 0, len(endpoints)*virtualNodes)
+	for node, ep := range endpoints {
+		address := ep.GetURL().GetAddressStr()
+		for n := 0; n < (virtualNodes+3)/4; n++ {
+			digest := md5.Sum([]byte(address + "-" + strconv.Itoa(n)))
+			for i := 0; i < 4; i++ {
+				points = append(points, ringPoint{hash: ketamaHash(digest[i*4 : i*4+4]), node: node})
+			}
+		}
+	}
+	sort.Sort(points)
+	r.points = make([]uint32, len(points))
+	r.nodes = make([]int, len(points))
+	for i, p := range points {
+		r.points[i] = p.hash
+		r.nodes[i] = p.node
+	}
+	return r
+}
+
+type ringPoint struct {
+	hash uint32
+	node int
+}
+
+// ringPoints sorts points by hash
+type ringPoints []ringPoint
+
+func (r ringPoints) Len() int {
+	return len(r)
+}
+func (r ringPoints) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+func (r ringPoints) Less(i, j int) bool {
+	return r[i].hash < r[j].hash
+}
+
+func ketamaHash(b []byte) uint32 {
+	return uint32(b[3])<<24 | uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
+
+// lookup returns at most n distinct available endpoints from the position of key on the ring clockwise.
+// nil is returned if key is nil or ring is not built
+func (r *hashRing) lookup(key []byte, n int) []motan.EndPoint {
+	if r == nil || key == nil {
+		return nil
+	}
+	eps := make([]motan.EndPoint, 0, n)
+	if len(r.points) == 0 {
+		return eps
+	}
+	digest := md5.Sum(key)
+	hash := ketamaHash(digest[0:4])
+	start := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	seen := make([]bool, len(r.endpoints))
+	for i, count := 0, 0; i < len(r.points) && len(eps) < n && count < len(r.endpoints); i++ {
+		node := r.nodes[(start+i)%len(r.points)]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		count++
+		if ep := r.endpoints[node]; ep.IsAvailable() {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
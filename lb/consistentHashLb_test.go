@@ -0,0 +1,64 @@
+package lb
+
+import (
+	"strconv"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+)
+
+func TestConsistentHashLB(t *testing.T) {
+	url := &motan.URL{Parameters: map[string]string{HashKeyKey: "uid"}}
+	lb := &ConsistentHashLB{url: url}
+	endpoints := make([]motan.EndPoint, 0, 10)
+	for i := 0; i < 10; i++ {
+		endpoints = append(endpoints, lbTestMockEndpoint{MockEndpoint: &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8000 + i}}, index: i, isAvail: true})
+	}
+	lb.OnRefresh(endpoints)
+	request := func(uid int) motan.Request {
+		return &motan.MotanRequest{Attachment: map[string]string{"uid": strconv.Itoa(uid)}}
+	}
+	counts := make(map[int]int)
+	selected := make(map[int]motan.EndPoint)
+	for uid := 0; uid < 1000; uid++ {
+		ep := lb.Select(request(uid))
+		selected[uid] = ep
+		counts[ep.(lbTestMockEndpoint).index]++
+		if lb.Select(request(uid)) != ep {
+			t.Fatalf("same key should select same endpoint. uid:%d", uid)
+		}
+		eps := lb.SelectArray(request(uid))
+		if len(eps) != MaxSelectArraySize || eps[0] != ep || eps[1] == eps[0] || eps[2] == eps[1] || eps[2] == eps[0] {
+			t.Fatalf("select array should return distinct endpoints from the selected one. eps:%v", eps)
+		}
+	}
+	for i, c := range counts {
+		if c < 40 || c > 200 {
+			t.Errorf("keys are not balanced. endpoint:%d, count:%d", i, c)
+		}
+	}
+
+	// only keys of the removed endpoint are remapped
+	lb.OnRefresh(endpoints[1:])
+	for uid := 0; uid < 1000; uid++ {
+		ep := lb.Select(request(uid))
+		if selected[uid] != endpoints[0] && ep != selected[uid] {
+			t.Fatalf("key should not be remapped. uid:%d", uid)
+		}
+	}
+
+	// unavailable endpoint is skipped
+	lb.OnRefresh(endpoints)
+	down := selected[0].(lbTestMockEndpoint)
+	down.isAvail = false
+	replaced := append([]motan.EndPoint{}, endpoints...)
+	replaced[down.index] = down
+	lb.OnRefresh(replaced)
+	if ep := lb.Select(request(0)); ep == nil || ep.(lbTestMockEndpoint).index == down.index {
+		t.Errorf("unavailable endpoint should be skipped. ep:%v", ep)
+	}
+	if ep := lb.Select(&motan.MotanRequest{}); ep == nil {
+		t.Errorf("request without hash key should be selected at random")
+	}
+}
@@ -12,8 +12,15 @@ import (
 
 // ext name
 const (
-	Random     = "random"
-	Roundrobin = "roundrobin"
+	Random         = "random"
+	Roundrobin     = "roundrobin"
+	ConsistentHash = "consistentHash"
+	LeastActive    = "leastActive"
+	PeakEWMA       = "peakEwma"
+
+	WeightedRoundrobin = "weightedRoundrobin" // smooth weighted round-robin by node weights
+	WeightedRandom     = "weightedRandom"     // weighted random by node weights
+	Affinity           = "affinity"           // session affinity by request attachment
 )
 
 const (
@@ -33,6 +40,30 @@ func RegistDefaultLb(extFactory motan.ExtentionFactory) {
 	extFactory.RegistExtLb(Roundrobin, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
 		return &RoundrobinLB{url: url}
 	}))
+
+	extFactory.RegistExtLb(ConsistentHash, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &ConsistentHashLB{url: url}
+	}))
+
+	extFactory.RegistExtLb(LeastActive, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &LeastActiveLB{url: url}
+	}))
+
+	extFactory.RegistExtLb(PeakEWMA, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &PeakEWMALB{url: url}
+	}))
+
+	extFactory.RegistExtLb(WeightedRoundrobin, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &WeightedRoundrobinLB{url: url}
+	}))
+
+	extFactory.RegistExtLb(WeightedRandom, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &WeightedRandomLB{url: url}
+	}))
+
+	extFactory.RegistExtLb(Affinity, NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &AffinityLB{url: url}
+	}))
 }
 
 // WeightedLbWraper support multi group weighted LB
@@ -41,15 +72,19 @@ type WeightedLbWraper struct {
 	weightstring string
 	refers       innerRefers
 	newLb        motan.NewLbFunc
+	warmup       *warmup
 }
 
 func NewWeightLbFunc(newLb motan.NewLbFunc) motan.NewLbFunc {
 	return func(url *motan.URL) motan.LoadBalance {
-		return &WeightedLbWraper{url: url, newLb: newLb, refers: &singleGroupRefers{lb: newLb(url)}}
+		return &WeightedLbWraper{url: url, newLb: newLb, refers: &singleGroupRefers{lb: newLb(url)}, warmup: newWarmup(url)}
 	}
 }
 
 func (w *WeightedLbWraper) OnRefresh(endpoints []motan.EndPoint) {
+	if w.warmup != nil {
+		w.warmup.onRefresh(endpoints)
+	}
 	if w.weightstring == "" { //not weighted lb
 		if sgr, ok := w.refers.(*singleGroupRefers); ok {
 			sgr.lb.OnRefresh(endpoints)
@@ -121,11 +156,30 @@ func (w *WeightedLbWraper) OnRefresh(endpoints []motan.EndPoint) {
 }
 
 func (w *WeightedLbWraper) Select(request motan.Request) motan.EndPoint {
-	return w.refers.selectNext(request)
+	ep := w.refers.selectNext(request)
+	for i := 0; i < maxWarmupRetry && !w.warmup.accept(ep); i++ {
+		next := w.refers.selectNext(request)
+		if next == ep { // deterministic lb such as consistent hash, skip the warming endpoint in its order instead
+			if eps := w.warmup.skip(w.refers.selectNextArray(request)); len(eps) > 0 {
+				return eps[0]
+			}
+			return ep
+		}
+		ep = next
+	}
+	return ep
 }
 
 func (w *WeightedLbWraper) SelectArray(request motan.Request) []motan.EndPoint {
-	return w.refers.selectNextArray(request)
+	eps := w.refers.selectNextArray(request)
+	for i := 0; i < maxWarmupRetry && len(eps) > 0 && !w.warmup.accept(eps[0]); i++ {
+		next := w.refers.selectNextArray(request)
+		if len(next) > 0 && next[0] == eps[0] {
+			return w.warmup.skip(next)
+		}
+		eps = next
+	}
+	return eps
 }
 
 func (w *WeightedLbWraper) SetWeight(weight string) {
@@ -225,3 +279,21 @@ func SelectOneAtRandom(endpoints []motan.EndPoint) (int, motan.EndPoint) {
 	}
 	return -1, nil
 }
+
+// selectTwoChoices selects two endpoints at random and returns the better one according to less (power of two choices).
+// unavailable endpoints are not selected.
+func selectTwoChoices(endpoints []motan.EndPoint, less func(i, j int) bool) (int, motan.EndPoint) {
+	epsLen := len(endpoints)
+	first, ep := SelectOneAtRandom(endpoints)
+	if ep == nil || epsLen == 1 {
+		return first, ep
+	}
+	second := rand.Intn(epsLen - 1)
+	if second >= first {
+		second++
+	}
+	if endpoints[second].IsAvailable() && less(second, first) {
+		return second, endpoints[second]
+	}
+	return first, ep
+}
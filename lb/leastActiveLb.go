@@ -0,0 +1,88 @@
+package lb
+
+import (
+	"sync/atomic"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// LeastActiveLB selects the endpoint with less in-flight calls of two random endpoints.
+// the endpoints are wrapped to count in-flight calls, and the counts are kept across refreshes.
+type LeastActiveLB struct {
+	url       *motan.URL
+	endpoints []motan.EndPoint
+	weight    string
+}
+
+// activeEndpoint counts the in-flight calls of endpoint
+type activeEndpoint struct {
+	motan.EndPoint
+	active int64
+}
+
+func (a *activeEndpoint) Call(request motan.Request) motan.Response {
+	atomic.AddInt64(&a.active, 1)
+	defer atomic.AddInt64(&a.active, -1)
+	return a.EndPoint.Call(request)
+}
+
+func (a *activeEndpoint) getActive() int64 {
+	return atomic.LoadInt64(&a.active)
+}
+
+func (a *activeEndpoint) unwrap() motan.EndPoint {
+	return a.EndPoint
+}
+
+func (l *LeastActiveLB) OnRefresh(endpoints []motan.EndPoint) {
+	l.endpoints = rewrapEndpoints(l.endpoints, endpoints, func(ep motan.EndPoint) wrappedEndpoint {
+		return &activeEndpoint{EndPoint: ep}
+	})
+}
+
+// wrappedEndpoint is an endpoint wrapper keeping call statistics
+type wrappedEndpoint interface {
+	motan.EndPoint
+	unwrap() motan.EndPoint
+}
+
+// rewrapEndpoints wraps the refreshed endpoints. the wrappers of unchanged endpoints are reused to keep statistics
+func rewrapEndpoints(wrapped []motan.EndPoint, endpoints []motan.EndPoint, wrap func(motan.EndPoint) wrappedEndpoint) []motan.EndPoint {
+	old := make(map[string]wrappedEndpoint, len(wrapped))
+	for _, ep := range wrapped {
+		old[ep.GetURL().GetIdentity()] = ep.(wrappedEndpoint)
+	}
+	eps := make([]motan.EndPoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if w, ok := old[ep.GetURL().GetIdentity()]; ok && w.unwrap() == ep {
+			eps = append(eps, w)
+		} else {
+			eps = append(eps, wrap(ep))
+		}
+	}
+	return eps
+}
+
+func (l *LeastActiveLB) Select(request motan.Request) motan.EndPoint {
+	_, endpoint := l.leastActiveSelect(l.endpoints)
+	return endpoint
+}
+
+func (l *LeastActiveLB) SelectArray(request motan.Request) []motan.EndPoint {
+	eps := l.endpoints
+	index, endpoint := l.leastActiveSelect(eps)
+	if endpoint == nil {
+		return nil
+	}
+	return SelectArrayFromIndex(eps, index)
+}
+
+func (l *LeastActiveLB) SetWeight(weight string) {
+	l.weight = weight
+}
+
+func (l *LeastActiveLB) leastActiveSelect(eps []motan.EndPoint) (int, motan.EndPoint) {
+	return selectTwoChoices(eps, func(i, j int) bool {
+		return eps[i].(*activeEndpoint).getActive() < eps[j].(*activeEndpoint).getActive()
+	})
+}
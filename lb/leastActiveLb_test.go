@@ -0,0 +1,47 @@
+package lb
+
+import (
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+)
+
+func TestLeastActiveLB(t *testing.T) {
+	lb := &LeastActiveLB{url: &motan.URL{}}
+	endpoints := make([]motan.EndPoint, 0, 4)
+	for port := 8001; port <= 8004; port++ {
+		endpoints = append(endpoints, &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: port}})
+	}
+	lb.OnRefresh(endpoints[:2])
+	busy := lb.endpoints[0].(*activeEndpoint)
+	busy.active = 10
+	for i := 0; i < 100; i++ {
+		if ep := lb.Select(nil); ep == busy {
+			t.Fatalf("endpoint with more active calls should not be selected")
+		}
+	}
+	if eps := lb.SelectArray(nil); len(eps) != 2 || eps[0] == busy {
+		t.Errorf("select array not correct. eps:%v", eps)
+	}
+
+	// active count is kept after refresh
+	lb.OnRefresh(endpoints)
+	if lb.endpoints[0] != busy || busy.getActive() != 10 {
+		t.Errorf("active count should be kept after refresh")
+	}
+	counts := make(map[motan.EndPoint]int)
+	for i := 0; i < 1000; i++ {
+		counts[lb.Select(nil)]++
+	}
+	if counts[busy] != 0 || len(counts) != 3 {
+		t.Errorf("endpoints should be selected except the busy one. counts:%v", counts)
+	}
+
+	busy.active = 0
+	ep := lb.Select(nil)
+	ep.Call(&motan.MotanRequest{})
+	if ep.(*activeEndpoint).getActive() != 0 {
+		t.Errorf("active count should be 0 after call")
+	}
+}
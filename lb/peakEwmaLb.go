@@ -0,0 +1,144 @@
+package lb
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// peak ewma settings of refer url
+const (
+	EWMADecayKey        = "ewmaDecay"        // decay time of latency average in millisecond
+	EWMAErrorPenaltyKey = "ewmaErrorPenalty" // latency penalty of a failed call in millisecond. the penalty decays 10 times faster than latency
+)
+
+const (
+	defaultEWMADecay        = 10000
+	defaultEWMAErrorPenalty = 1000
+	ewmaErrorDecayRatio     = 10
+)
+
+// PeakEWMALB selects the endpoint with lower cost of two random endpoints.
+// the cost is latency * (inflight + 1), and the latency is the peak-sensitive exponentially weighted moving average
+// of response time: a slower response is taken immediately, while faster responses lower the average gradually.
+// failed calls add a latency penalty, so the endpoint is avoided until the penalty decays.
+type PeakEWMALB struct {
+	url       *motan.URL
+	endpoints []motan.EndPoint
+	weight    string
+}
+
+// ewmaEndpoint records the latency and in-flight calls of endpoint
+type ewmaEndpoint struct {
+	motan.EndPoint
+	decay      float64 // nanoseconds
+	errorDecay float64 // nanoseconds
+	penalty    float64 // nanoseconds
+	inflight   int64
+
+	lock        sync.Mutex
+	latency     float64 // nanoseconds
+	lastPenalty float64 // nanoseconds
+	stamp       int64   // unix nano of last update
+}
+
+func newEWMAEndpoint(ep motan.EndPoint, url *motan.URL) *ewmaEndpoint {
+	decay := float64(url.GetPositiveIntValue(EWMADecayKey, defaultEWMADecay) * int64(time.Millisecond))
+	return &ewmaEndpoint{
+		EndPoint:   ep,
+		decay:      decay,
+		errorDecay: decay / ewmaErrorDecayRatio,
+		penalty:    float64(url.GetPositiveIntValue(EWMAErrorPenaltyKey, defaultEWMAErrorPenalty) * int64(time.Millisecond)),
+		stamp:      time.Now().UnixNano(),
+	}
+}
+
+func (e *ewmaEndpoint) Call(request motan.Request) motan.Response {
+	atomic.AddInt64(&e.inflight, 1)
+	start := time.Now()
+	response := e.EndPoint.Call(request)
+	atomic.AddInt64(&e.inflight, -1)
+	failed := response == nil || (response.GetException() != nil && response.GetException().ErrType != motan.BizException)
+	e.observe(time.Since(start), failed)
+	return response
+}
+
+func (e *ewmaEndpoint) unwrap() motan.EndPoint {
+	return e.EndPoint
+}
+
+// observe updates latency with rtt. the penalty is raised if the call is failed
+func (e *ewmaEndpoint) observe(rtt time.Duration, failed bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.update(float64(rtt), failed)
+}
+
+// update must be called with lock held
+func (e *ewmaEndpoint) update(rtt float64, failed bool) {
+	now := time.Now().UnixNano()
+	td := float64(now - e.stamp)
+	if td < 0 {
+		td = 0
+	}
+	e.stamp = now
+	e.lastPenalty *= math.Exp(-td / e.errorDecay)
+	if failed {
+		e.lastPenalty = math.Max(e.lastPenalty, e.penalty)
+		return
+	}
+	if rtt > e.latency {
+		e.latency = rtt
+	} else {
+		w := math.Exp(-td / e.decay)
+		e.latency = e.latency*w + rtt*(1-w)
+	}
+}
+
+// cost returns the current cost of endpoint. the latency decays while the endpoint is not called.
+// an endpoint without latency, e.g. a new endpoint, costs the penalty if it has in-flight calls,
+// so requests do not pile up on it before the first response.
+func (e *ewmaEndpoint) cost() float64 {
+	e.lock.Lock()
+	e.update(0, false)
+	latency := e.latency + e.lastPenalty
+	e.lock.Unlock()
+	inflight := atomic.LoadInt64(&e.inflight)
+	if latency == 0 && inflight > 0 {
+		return e.penalty + float64(inflight)
+	}
+	return latency * float64(inflight+1)
+}
+
+func (p *PeakEWMALB) OnRefresh(endpoints []motan.EndPoint) {
+	p.endpoints = rewrapEndpoints(p.endpoints, endpoints, func(ep motan.EndPoint) wrappedEndpoint {
+		return newEWMAEndpoint(ep, p.url)
+	})
+}
+
+func (p *PeakEWMALB) Select(request motan.Request) motan.EndPoint {
+	_, endpoint := p.ewmaSelect(p.endpoints)
+	return endpoint
+}
+
+func (p *PeakEWMALB) SelectArray(request motan.Request) []motan.EndPoint {
+	eps := p.endpoints
+	index, endpoint := p.ewmaSelect(eps)
+	if endpoint == nil {
+		return nil
+	}
+	return SelectArrayFromIndex(eps, index)
+}
+
+func (p *PeakEWMALB) SetWeight(weight string) {
+	p.weight = weight
+}
+
+func (p *PeakEWMALB) ewmaSelect(eps []motan.EndPoint) (int, motan.EndPoint) {
+	return selectTwoChoices(eps, func(i, j int) bool {
+		return eps[i].(*ewmaEndpoint).cost() < eps[j].(*ewmaEndpoint).cost()
+	})
+}
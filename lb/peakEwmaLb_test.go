@@ -0,0 +1,76 @@
+package lb
+
+import (
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+)
+
+func TestPeakEWMALB(t *testing.T) {
+	lb := &PeakEWMALB{url: &motan.URL{Parameters: map[string]string{EWMADecayKey: "100"}}}
+	endpoints := []motan.EndPoint{
+		&endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8001}},
+		&endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8002}},
+	}
+	lb.OnRefresh(endpoints)
+	slow := lb.endpoints[0].(*ewmaEndpoint)
+	fast := lb.endpoints[1].(*ewmaEndpoint)
+	slow.observe(100*time.Millisecond, false)
+	fast.observe(time.Millisecond, false)
+	for i := 0; i < 20; i++ {
+		if ep := lb.Select(nil); ep != fast {
+			t.Fatalf("endpoint with lower latency should be selected")
+		}
+	}
+
+	// in-flight calls raise the cost
+	fast.inflight = 1000
+	if ep := lb.Select(nil); ep != slow {
+		t.Errorf("endpoint with less in-flight calls should be selected")
+	}
+	fast.inflight = 0
+
+	// failed call adds a penalty which decays quickly
+	fast.observe(time.Millisecond, true)
+	if ep := lb.Select(nil); ep != slow {
+		t.Errorf("failed endpoint should be avoided")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ep := lb.Select(nil); ep != fast {
+		t.Errorf("penalty of failed endpoint should decay")
+	}
+
+	lb.OnRefresh(endpoints)
+	if lb.endpoints[0] != slow {
+		t.Errorf("endpoint stats should be kept after refresh")
+	}
+	lb.Select(nil).Call(&motan.MotanRequest{})
+	if slow.inflight != 0 || fast.inflight != 0 {
+		t.Errorf("in-flight calls should be 0 after call")
+	}
+}
+
+func TestPeakEWMALBColdStart(t *testing.T) {
+	lb := &PeakEWMALB{url: &motan.URL{Parameters: map[string]string{}}}
+	lb.OnRefresh([]motan.EndPoint{
+		&endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8001}},
+		&endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8002}},
+	})
+	busy := lb.endpoints[0].(*ewmaEndpoint)
+	idle := lb.endpoints[1].(*ewmaEndpoint)
+	busy.inflight = 1
+	if busy.cost() <= idle.cost() {
+		t.Fatalf("new endpoint with in-flight calls should cost more. busy:%f, idle:%f", busy.cost(), idle.cost())
+	}
+	for i := 0; i < 20; i++ {
+		if ep := lb.Select(nil); ep != idle {
+			t.Fatalf("new endpoint without in-flight calls should be selected")
+		}
+	}
+	busy.inflight = 2
+	if cost := busy.cost(); cost <= busy.penalty+1 {
+		t.Errorf("cost should grow with in-flight calls. cost:%f", cost)
+	}
+}
@@ -0,0 +1,102 @@
+package lb
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// WarmupKey is the refer url param of warmup period in millisecond. during the period, the effective weight of
+// a newly added endpoint ramps linearly from minWarmupFactor to full, so servers that need warmup are not overloaded.
+// it is applied by WeightedLbWraper, so all load balances created by NewWeightLbFunc support warmup. deterministic
+// load balances like consistent hash skip a warming endpoint to the next one in their order in proportion to the factor.
+const WarmupKey = "warmup"
+
+const (
+	minWarmupFactor = 0.1
+	maxWarmupRetry  = 3
+)
+
+// warmup records the time endpoints are added. endpoints of the first refresh are regarded as warmed up.
+type warmup struct {
+	period     time.Duration
+	lock       sync.RWMutex
+	startTimes map[string]time.Time
+	refreshed  bool
+}
+
+// newWarmup returns nil if warmup is not enabled in url
+func newWarmup(url *motan.URL) *warmup {
+	if url == nil {
+		return nil
+	}
+	period := url.GetTimeDuration(WarmupKey, time.Millisecond, 0)
+	if period <= 0 {
+		return nil
+	}
+	return &warmup{period: period, startTimes: make(map[string]time.Time)}
+}
+
+func (w *warmup) onRefresh(endpoints []motan.EndPoint) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := time.Now()
+	if !w.refreshed {
+		now = now.Add(-w.period)
+		w.refreshed = true
+	}
+	startTimes := make(map[string]time.Time, len(endpoints))
+	for _, ep := range endpoints {
+		id := ep.GetURL().GetIdentity()
+		if t, ok := w.startTimes[id]; ok {
+			startTimes[id] = t
+		} else {
+			startTimes[id] = now
+		}
+	}
+	w.startTimes = startTimes
+}
+
+// factor returns the effective weight factor of the endpoint in (0, 1]
+func (w *warmup) factor(ep motan.EndPoint) float64 {
+	w.lock.RLock()
+	start, ok := w.startTimes[ep.GetURL().GetIdentity()]
+	w.lock.RUnlock()
+	if !ok {
+		return 1
+	}
+	elapsed := time.Since(start)
+	if elapsed >= w.period {
+		return 1
+	}
+	return minWarmupFactor + (1-minWarmupFactor)*float64(elapsed)/float64(w.period)
+}
+
+// accept returns whether a selected endpoint is accepted according to its warmup factor. a rejected endpoint
+// should be reselected, so the chance of the endpoint is in proportion to the factor.
+func (w *warmup) accept(ep motan.EndPoint) bool {
+	if w == nil || ep == nil {
+		return true
+	}
+	f := w.factor(ep)
+	return f >= 1 || rand.Float64() < f
+}
+
+// skip moves the first accepted endpoint to the front, the order of others is kept.
+// the endpoints are returned as is if none is accepted.
+func (w *warmup) skip(eps []motan.EndPoint) []motan.EndPoint {
+	for i, ep := range eps {
+		if w.accept(ep) {
+			if i == 0 {
+				return eps
+			}
+			result := make([]motan.EndPoint, 0, len(eps))
+			result = append(result, ep)
+			result = append(result, eps[:i]...)
+			return append(result, eps[i+1:]...)
+		}
+	}
+	return eps
+}
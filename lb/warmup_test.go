@@ -0,0 +1,78 @@
+package lb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+)
+
+func TestWarmup(t *testing.T) {
+	url := &motan.URL{Parameters: map[string]string{WarmupKey: "300"}}
+	lb := NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &RoundrobinLB{url: url}
+	})(url)
+	endpoints := make([]motan.EndPoint, 0, 5)
+	for port := 8001; port <= 8004; port++ {
+		endpoints = append(endpoints, &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: port}})
+	}
+	lb.OnRefresh(endpoints)
+	newEp := &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8005}}
+	lb.OnRefresh(append(endpoints, newEp))
+
+	count := func() int {
+		c := 0
+		for i := 0; i < 1000; i++ {
+			if lb.Select(nil) == newEp {
+				c++
+			}
+		}
+		return c
+	}
+	// the share of new endpoint is about 1/5 * 0.1 at the beginning of warmup
+	if c := count(); c > 100 {
+		t.Fatalf("new endpoint should be selected less during warmup. count:%d", c)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if c := count(); c < 150 {
+		t.Fatalf("new endpoint should get full share after warmup. count:%d", c)
+	}
+}
+
+func TestWarmupDeterministic(t *testing.T) {
+	url := &motan.URL{Parameters: map[string]string{WarmupKey: "300", HashKeyKey: "uid"}}
+	lb := NewWeightLbFunc(func(url *motan.URL) motan.LoadBalance {
+		return &ConsistentHashLB{url: url}
+	})(url)
+	endpoints := make([]motan.EndPoint, 0, 5)
+	for port := 8001; port <= 8004; port++ {
+		endpoints = append(endpoints, &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: port}})
+	}
+	lb.OnRefresh(endpoints)
+	newEp := &endpoint.MockEndpoint{URL: &motan.URL{Host: "127.0.0.1", Port: 8005}}
+	lb.OnRefresh(append(endpoints, newEp))
+
+	count := func() (int, int) {
+		c, ca := 0, 0
+		for uid := 0; uid < 1000; uid++ {
+			request := &motan.MotanRequest{Attachment: map[string]string{"uid": strconv.Itoa(uid)}}
+			if lb.Select(request) == newEp {
+				c++
+			}
+			if eps := lb.SelectArray(request); len(eps) > 0 && eps[0] == newEp {
+				ca++
+			}
+		}
+		return c, ca
+	}
+	// keys of new endpoint are about 1/5, and most of them go to the next endpoint on the ring at the beginning
+	if c, ca := count(); c > 100 || ca > 100 {
+		t.Fatalf("new endpoint should be selected less during warmup. count:%d, array count:%d", c, ca)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if c, ca := count(); c < 100 || ca < 100 {
+		t.Fatalf("new endpoint should get its keys after warmup. count:%d, array count:%d", c, ca)
+	}
+}
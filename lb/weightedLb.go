@@ -0,0 +1,166 @@
+package lb
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+const maxNodeWeight = 100
+
+// nodeWeight returns the weight param of endpoint url published by registry.
+// the weight is normalized to default weight if it is missing or not in [1, 100].
+func nodeWeight(ep motan.EndPoint) int {
+	w, err := strconv.Atoi(ep.GetURL().GetParam(motan.WeightKey, ""))
+	if err != nil || w < 1 || w > maxNodeWeight {
+		return defaultWeight
+	}
+	return w
+}
+
+// WeightedRoundrobinLB is the smooth weighted round-robin by node weights. the endpoints are selected evenly
+// in proportion to their weights, e.g. weights 5,1,1 select a,a,b,a,c,a,a instead of a,a,a,a,a,b,c.
+type WeightedRoundrobinLB struct {
+	url       *motan.URL
+	lock      sync.Mutex
+	endpoints []motan.EndPoint
+	weights   []int
+	current   []int
+	weight    string
+}
+
+func (w *WeightedRoundrobinLB) OnRefresh(endpoints []motan.EndPoint) {
+	weights := make([]int, len(endpoints))
+	for i, ep := range endpoints {
+		weights[i] = nodeWeight(ep)
+	}
+	w.lock.Lock()
+	w.endpoints = endpoints
+	w.weights = weights
+	w.current = make([]int, len(endpoints))
+	w.lock.Unlock()
+}
+
+func (w *WeightedRoundrobinLB) Select(request motan.Request) motan.EndPoint {
+	_, endpoint := w.weightedSelect()
+	return endpoint
+}
+
+func (w *WeightedRoundrobinLB) SelectArray(request motan.Request) []motan.EndPoint {
+	index, endpoint := w.weightedSelect()
+	if endpoint == nil {
+		return nil
+	}
+	w.lock.Lock()
+	eps := w.endpoints
+	w.lock.Unlock()
+	return SelectArrayFromIndex(eps, index)
+}
+
+func (w *WeightedRoundrobinLB) SetWeight(weight string) {
+	w.weight = weight
+}
+
+// weightedSelect adds the weight to current weight of each available endpoint, selects the one with max current
+// weight, and subtracts the total weight from the selected one.
+func (w *WeightedRoundrobinLB) weightedSelect() (int, motan.EndPoint) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	best, total := -1, 0
+	for i, ep := range w.endpoints {
+		if !ep.IsAvailable() {
+			continue
+		}
+		w.current[i] += w.weights[i]
+		total += w.weights[i]
+		if best < 0 || w.current[i] > w.current[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return -1, nil
+	}
+	w.current[best] -= total
+	return best, w.endpoints[best]
+}
+
+// WeightedRandomLB selects endpoints at random in proportion to node weights
+type WeightedRandomLB struct {
+	url       *motan.URL
+	endpoints []motan.EndPoint
+	sums      []int // prefix sums of weights
+	weight    string
+}
+
+func (w *WeightedRandomLB) OnRefresh(endpoints []motan.EndPoint) {
+	sums := make([]int, len(endpoints))
+	total := 0
+	for i, ep := range endpoints {
+		total += nodeWeight(ep)
+		sums[i] = total
+	}
+	w.sums = sums
+	w.endpoints = endpoints
+}
+
+func (w *WeightedRandomLB) Select(request motan.Request) motan.EndPoint {
+	_, endpoint := w.weightedSelect(w.endpoints, w.sums)
+	return endpoint
+}
+
+func (w *WeightedRandomLB) SelectArray(request motan.Request) []motan.EndPoint {
+	eps := w.endpoints
+	index, endpoint := w.weightedSelect(eps, w.sums)
+	if endpoint == nil {
+		return nil
+	}
+	return SelectArrayFromIndex(eps, index)
+}
+
+func (w *WeightedRandomLB) SetWeight(weight string) {
+	w.weight = weight
+}
+
+// weightedSelect selects an endpoint by weight. if the selected one is unavailable, an endpoint is reselected by
+// weight among the available ones.
+func (w *WeightedRandomLB) weightedSelect(eps []motan.EndPoint, sums []int) (int, motan.EndPoint) {
+	if len(eps) == 0 || len(sums) != len(eps) {
+		return SelectOneAtRandom(eps)
+	}
+	r := rand.Intn(sums[len(sums)-1])
+	index := sort.Search(len(sums), func(i int) bool {
+		return sums[i] > r
+	})
+	if eps[index].IsAvailable() {
+		return index, eps[index]
+	}
+	available := make([]int, 0, len(eps))
+	total := 0
+	for i, ep := range eps {
+		if ep.IsAvailable() {
+			available = append(available, i)
+			total += weightAt(sums, i)
+		}
+	}
+	if total == 0 {
+		return -1, nil
+	}
+	r = rand.Intn(total)
+	for _, i := range available {
+		if r -= weightAt(sums, i); r < 0 {
+			return i, eps[i]
+		}
+	}
+	return -1, nil
+}
+
+// weightAt returns the weight at index of prefix sums
+func weightAt(sums []int, i int) int {
+	if i == 0 {
+		return sums[0]
+	}
+	return sums[i] - sums[i-1]
+}
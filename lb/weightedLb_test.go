@@ -0,0 +1,77 @@
+package lb
+
+import (
+	"strconv"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+)
+
+func weightedEndpoints(weights ...int) []motan.EndPoint {
+	endpoints := make([]motan.EndPoint, 0, len(weights))
+	for i, w := range weights {
+		url := &motan.URL{Host: "127.0.0.1", Port: 8001 + i, Parameters: map[string]string{motan.WeightKey: strconv.Itoa(w)}}
+		endpoints = append(endpoints, &endpoint.MockEndpoint{URL: url})
+	}
+	return endpoints
+}
+
+func TestWeightedRoundrobinLB(t *testing.T) {
+	lb := &WeightedRoundrobinLB{url: &motan.URL{}}
+	endpoints := weightedEndpoints(5, 1, 1)
+	lb.OnRefresh(endpoints)
+	// smooth weighted round-robin spreads the heavy endpoint
+	expect := []int{0, 0, 1, 0, 2, 0, 0}
+	for i, e := range expect {
+		if ep := lb.Select(nil); ep != endpoints[e] {
+			t.Fatalf("select not smooth. index:%d, expect:%d, ep:%v", i, e, ep.GetURL().Port)
+		}
+	}
+
+	// weights are updated on refresh
+	endpoints[0].(*endpoint.MockEndpoint).URL.Parameters[motan.WeightKey] = "1"
+	lb.OnRefresh(endpoints)
+	counts := make(map[motan.EndPoint]int)
+	for i := 0; i < 30; i++ {
+		counts[lb.Select(nil)]++
+	}
+	for _, ep := range endpoints {
+		if counts[ep] != 10 {
+			t.Errorf("endpoints with same weight should be selected equally. counts:%v", counts)
+		}
+	}
+	if eps := lb.SelectArray(nil); len(eps) != MaxSelectArraySize {
+		t.Errorf("select array not correct. eps:%v", eps)
+	}
+}
+
+func TestWeightedRandomLB(t *testing.T) {
+	lb := &WeightedRandomLB{url: &motan.URL{}}
+	endpoints := weightedEndpoints(8, 1, 1)
+	lb.OnRefresh(endpoints)
+	counts := make(map[motan.EndPoint]int)
+	for i := 0; i < 10000; i++ {
+		counts[lb.Select(nil)]++
+	}
+	if counts[endpoints[0]] < 7000 || counts[endpoints[0]] > 9000 {
+		t.Errorf("endpoints should be selected by weight. counts:%v", counts)
+	}
+
+	// unavailable endpoint is reselected by weight among available endpoints
+	endpoints = weightedEndpoints(6, 9, 1)
+	for i, ep := range endpoints {
+		endpoints[i] = lbTestMockEndpoint{MockEndpoint: ep.(*endpoint.MockEndpoint), index: i, isAvail: i != 0}
+	}
+	lb.OnRefresh(endpoints)
+	counts = make(map[motan.EndPoint]int)
+	for i := 0; i < 10000; i++ {
+		counts[lb.Select(nil)]++
+	}
+	if counts[endpoints[0]] != 0 || counts[endpoints[1]] < 8500 || counts[endpoints[1]] > 9500 {
+		t.Errorf("available endpoints should be reselected by weight. counts:%v", counts)
+	}
+	if nodeWeight(weightedEndpoints(0)[0]) != defaultWeight || nodeWeight(weightedEndpoints(101)[0]) != defaultWeight {
+		t.Errorf("invalid weight should be normalized to default weight")
+	}
+}
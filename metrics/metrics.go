@@ -138,6 +138,8 @@ func (r *reporter) processEvent(evt *event) {
 		getOrRegisterMeter(evt.key, r.registry).Mark(evt.value)
 	case eventTimer:
 		metrics.GetOrRegisterTimer(evt.key, r.registry).Update(time.Duration(evt.value))
+	case eventGauge:
+		metrics.GetOrRegisterGauge(evt.key, r.registry).Update(evt.value)
 	case eventHistograms:
 		metrics.GetOrRegisterHistogram(evt.key, r.registry, r.Sample(evt.key)).Update(evt.value)
 
@@ -195,6 +197,18 @@ func AddTimer(key string, duration int64) {
 	}
 }
 
+func AddGauge(key string, value int64) {
+	evt := reg.evtBuf.Get().(*event)
+	evt.event = eventGauge
+	evt.key = key
+	evt.value = value
+	select {
+	case reg.eventBus <- evt:
+	default:
+		vlog.Warningln("metrics eventBus is full.")
+	}
+}
+
 func AddHistograms(key string, duration int64) {
 	evt := reg.evtBuf.Get().(*event)
 	evt.event = eventHistograms
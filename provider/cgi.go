@@ -5,11 +5,13 @@ package provider
 import (
 	"errors"
 	"fmt"
-	cgi "github.com/beberlei/fastcgi-serve/fcgiclient"
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
+	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	// "github.com/yangchenxing/go-nginx-conf-parser"
 )
@@ -22,17 +24,88 @@ const (
 	HTTPMethodGET  = "GET"
 )
 
+// cgi provider settings from service url
+const (
+	CGITimeoutKey             = "CGI_TIMEOUT"               // request timeout in millisecond
+	CGIMaxIdleConnsKey        = "CGI_MAX_IDLE_CONNS"        // max idle keep-alive connections to the backend
+	CGIHealthIntervalKey      = "CGI_HEALTH_INTERVAL"       // backend probing interval in millisecond
+	CGIHealthFailThresholdKey = "CGI_HEALTH_FAIL_THRESHOLD" // provider is unavailable after continuous probing failures
+)
+
+const (
+	defaultCGITimeout             = 1000
+	defaultCGIMaxIdleConns        = 16
+	defaultCGIHealthInterval      = 3000
+	defaultCGIHealthFailThreshold = 3
+)
+
 var serverEnvironment = map[string]string{"SERVER_SOFTWARE": "Motan / CGI"}
 var NeededCGIEnv = []string{"REQUEST_METHOD", "SCRIPT_FILENAME", "DOCUMENT_ROOT"}
 
 type CgiProvider struct {
-	url *motan.URL
+	url         *motan.URL
+	pool        *fcgiPool
+	timeout     time.Duration
+	available   int32
+	failCount   int
+	destroyCh   chan struct{}
+	destroyOnce sync.Once
 }
 
 func (c *CgiProvider) Initialize() {
+	cgiHost := DefaultCGIHost
+	cgiPort := DefaultCGIPort
+	if host, ok := c.url.Parameters["CGI_HOST"]; ok {
+		cgiHost = host
+	}
+	if portStr, ok := c.url.Parameters["CGI_PORT"]; ok {
+		cgiPort, _ = strconv.Atoi(portStr)
+	}
+	addr := net.JoinHostPort(cgiHost, strconv.Itoa(cgiPort))
+	c.timeout = time.Duration(c.url.GetPositiveIntValue(CGITimeoutKey, defaultCGITimeout)) * time.Millisecond
+	c.pool = getFcgiPool(cgiHost, cgiPort, int(c.url.GetPositiveIntValue(CGIMaxIdleConnsKey, defaultCGIMaxIdleConns)), c.timeout)
+	c.available = 1
+	c.destroyCh = make(chan struct{})
+	go c.probeBackend(addr, time.Duration(c.url.GetPositiveIntValue(CGIHealthIntervalKey, defaultCGIHealthInterval))*time.Millisecond,
+		int(c.url.GetPositiveIntValue(CGIHealthFailThresholdKey, defaultCGIHealthFailThreshold)))
+}
+
+// probeBackend dial the backend periodically. the provider will be unavailable if the backend can not be
+// connected continuously, and the exporter will set the service unavailable in registries.
+func (c *CgiProvider) probeBackend(addr string, interval time.Duration, threshold int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.destroyCh:
+			return
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", addr, c.timeout)
+			if err != nil {
+				c.failCount++
+				if c.failCount >= threshold && atomic.CompareAndSwapInt32(&c.available, 1, 0) {
+					vlog.Warningf("cgi backend is unavailable. service:%s, backend:%s, err:%v\n", c.url.Path, addr, err)
+				}
+				continue
+			}
+			conn.Close()
+			c.failCount = 0
+			if atomic.CompareAndSwapInt32(&c.available, 0, 1) {
+				vlog.Infof("cgi backend is available. service:%s, backend:%s\n", c.url.Path, addr)
+			}
+		}
+	}
 }
 
 func (c *CgiProvider) Destroy() {
+	c.destroyOnce.Do(func() {
+		if c.destroyCh != nil {
+			close(c.destroyCh)
+		}
+		if c.pool != nil {
+			releaseFcgiPool(c.pool)
+		}
+	})
 }
 
 func (c *CgiProvider) SetSerialization(s motan.Serialization) {}
@@ -41,7 +114,6 @@ func (c *CgiProvider) SetProxy(proxy bool) {}
 
 func (c *CgiProvider) Call(request motan.Request) motan.Response {
 	defer func() {
-		// @TODO if cgi server die, should let server node unavailable
 		if err := recover(); err != nil {
 			vlog.Errorln("cgi provider call error! ", err)
 		}
@@ -85,21 +157,7 @@ func (c *CgiProvider) Call(request motan.Request) motan.Response {
 		env["CONTENT_LENGTH"] = strconv.Itoa(len(reqParams))
 	}
 
-	cgiHost := DefaultCGIHost
-	cgiPort := DefaultCGIPort
-	if host, ok := c.url.Parameters["CGI_HOST"]; ok {
-		cgiHost = host
-	}
-	if portStr, ok := c.url.Parameters["CGI_PORT"]; ok {
-		cgiPort, _ = strconv.Atoi(portStr)
-	}
-	ccgi, err := cgi.New(cgiHost, cgiPort)
-	if err != nil {
-		vlog.Errorf("new CGI err: %v", err)
-		fillException(resp, t, err)
-		return resp
-	}
-	content, _, err := ccgi.Request(env, reqParams)
+	content, _, err := c.pool.request(env, reqParams)
 	if err != nil {
 		vlog.Errorf("CGI Call error: %+v\n", err)
 		fillException(resp, t, err)
@@ -172,9 +230,9 @@ func (c *CgiProvider) SetURL(url *motan.URL) {
 	c.url = url
 }
 
+// IsAvailable returns false if the cgi backend can not be connected
 func (c *CgiProvider) IsAvailable() bool {
-	//TODO Provider 是否可用
-	return true
+	return atomic.LoadInt32(&c.available) == 1
 }
 
 func (c *CgiProvider) SetService(s interface{}) {
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+// testFcgiBackend is a fake FastCGI backend which replies every request with a fixed response
+type testFcgiBackend struct {
+	ln     net.Listener
+	conns  int32 // accepted connections
+	closed int32 // connections closed by client
+	once   bool  // close connection after a reply
+	hang   bool  // never reply
+}
+
+func newTestFcgiBackend(t *testing.T) *testFcgiBackend {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen fail. err:%v", err)
+	}
+	b := &testFcgiBackend{ln: ln}
+	go b.serve()
+	return b
+}
+
+func (b *testFcgiBackend) port() int {
+	return b.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (b *testFcgiBackend) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&b.conns, 1)
+		go func(conn net.Conn) {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			f := &fcgiConn{conn: conn, reader: reader}
+			header := make([]byte, fcgiHeaderLen)
+			for {
+				if _, err := io.ReadFull(reader, header); err != nil {
+					atomic.AddInt32(&b.closed, 1)
+					return
+				}
+				contentLen := int(binary.BigEndian.Uint16(header[4:]))
+				if _, err := io.CopyN(ioutil.Discard, reader, int64(contentLen+int(header[6]))); err != nil {
+					atomic.AddInt32(&b.closed, 1)
+					return
+				}
+				if header[1] == fcgiStdin && contentLen == 0 && !b.hang {
+					f.writeStream(fcgiStdout, []byte("Content-Type: text/plain\r\n\r\nhello"))
+					f.writeRecord(fcgiEndRequest, make([]byte, 8))
+					if b.once {
+						return
+					}
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestFcgiPool(t *testing.T) {
+	p1 := getFcgiPool("127.0.0.1", 9000, 2, time.Second)
+	p2 := getFcgiPool("127.0.0.1", 9000, 2, time.Second)
+	p3 := getFcgiPool("127.0.0.1", 9000, 4, time.Second)
+	if p1 != p2 || p1 == p3 {
+		t.Fatal("pool should be shared by same backend and settings only")
+	}
+	releaseFcgiPool(p1)
+	releaseFcgiPool(p2)
+	releaseFcgiPool(p3)
+	if len(fcgiPools) != 0 {
+		t.Fatalf("released pools should be removed. pools:%d", len(fcgiPools))
+	}
+
+	backend := newTestFcgiBackend(t)
+	defer backend.ln.Close()
+	pool := getFcgiPool("127.0.0.1", backend.port(), 2, time.Second)
+	for i := 0; i < 3; i++ {
+		if stdout, _, err := pool.request(nil, ""); err != nil || string(stdout) != "Content-Type: text/plain\r\n\r\nhello" {
+			t.Fatalf("fastcgi request fail. stdout:%s, err:%v", stdout, err)
+		}
+	}
+	if n := atomic.LoadInt32(&backend.conns); n != 1 {
+		t.Fatalf("connection should be kept alive. connections:%d", n)
+	}
+	releaseFcgiPool(pool)
+	if _, _, err := pool.request(nil, ""); err != errFcgiPoolClosed {
+		t.Fatalf("request of closed pool should fail. err:%v", err)
+	}
+	waitClosed := func(b *testFcgiBackend, n int32) bool {
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&b.closed) < n && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		return atomic.LoadInt32(&b.closed) >= n
+	}
+	if !waitClosed(backend, 1) {
+		t.Fatal("idle connection should be closed with pool")
+	}
+
+	// idle connection closed by backend is dropped before use
+	once := newTestFcgiBackend(t)
+	defer once.ln.Close()
+	once.once = true
+	pool = getFcgiPool("127.0.0.1", once.port(), 2, time.Second)
+	defer releaseFcgiPool(pool)
+	for i := 0; i < 2; i++ {
+		if _, _, err := pool.request(nil, ""); err != nil {
+			t.Fatalf("request after idle connection closed fail. err:%v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&once.conns); n != 2 {
+		t.Fatalf("stale connection should be replaced. connections:%d", n)
+	}
+
+	// connection of timeout request is closed
+	hang := newTestFcgiBackend(t)
+	defer hang.ln.Close()
+	hang.hang = true
+	slow := getFcgiPool("127.0.0.1", hang.port(), 2, 50*time.Millisecond)
+	defer releaseFcgiPool(slow)
+	if _, _, err := slow.request(nil, ""); err != errFcgiTimeout {
+		t.Fatalf("slow request should timeout. err:%v", err)
+	}
+	if !waitClosed(hang, 1) {
+		t.Fatal("connection of timeout request should be closed")
+	}
+}
+
+func TestCgiProvider(t *testing.T) {
+	backend := newTestFcgiBackend(t)
+	url := &motan.URL{Path: "test.cgi", Parameters: map[string]string{
+		"CGI_PORT":                strconv.Itoa(backend.port()),
+		"CGI_REQUEST_METHOD":      HTTPMethodGET,
+		CGIHealthIntervalKey:      "20",
+		CGIHealthFailThresholdKey: "2",
+	}}
+	provider := &CgiProvider{url: url}
+	provider.Initialize()
+	defer provider.Destroy()
+
+	res := provider.Call(&motan.MotanRequest{RequestID: 1, ServiceName: "test.cgi", Method: "hello", Attachment: make(map[string]string)})
+	if res.GetException() != nil || res.GetValue() != "hello" {
+		t.Fatalf("call cgi provider fail. res:%+v", res)
+	}
+
+	backend.ln.Close()
+	deadline := time.Now().Add(time.Second)
+	for provider.IsAvailable() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if provider.IsAvailable() {
+		t.Fatal("provider should be unavailable when backend is down")
+	}
+}
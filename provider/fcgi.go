@@ -0,0 +1,275 @@
+package provider
+
+// FastCGI spec: http://www.mit.edu/~yandros/doc/specs/fcgi-spec.html
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	fcgiVersion       = 1
+	fcgiBeginRequest  = 1
+	fcgiEndRequest    = 3
+	fcgiParams        = 4
+	fcgiStdin         = 5
+	fcgiStdout        = 6
+	fcgiStderr        = 7
+	fcgiResponder     = 1
+	fcgiKeepConn      = 1
+	fcgiRequestID     = 1 // requests on a connection are serial, so request id is always 1
+	fcgiMaxContentLen = 65535
+	fcgiHeaderLen     = 8
+)
+
+var (
+	errFcgiPoolClosed = errors.New("fastcgi pool is closed")
+	errFcgiTimeout    = errors.New("fastcgi request timeout")
+	fcgiPad           = make([]byte, 8)
+)
+
+// fcgiConn is a keep-alive FastCGI connection which process requests one by one
+type fcgiConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	buf    bytes.Buffer
+}
+
+func (f *fcgiConn) writeRecord(recType uint8, content []byte) error {
+	f.buf.Reset()
+	padding := uint8(-len(content) & 7)
+	header := [fcgiHeaderLen]byte{fcgiVersion, recType}
+	binary.BigEndian.PutUint16(header[2:], fcgiRequestID)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	header[6] = padding
+	f.buf.Write(header[:])
+	f.buf.Write(content)
+	f.buf.Write(fcgiPad[:padding])
+	_, err := f.conn.Write(f.buf.Bytes())
+	return err
+}
+
+// writeStream write content in records, and an empty record as the end of stream
+func (f *fcgiConn) writeStream(recType uint8, content []byte) error {
+	for len(content) > 0 {
+		n := len(content)
+		if n > fcgiMaxContentLen {
+			n = fcgiMaxContentLen
+		}
+		if err := f.writeRecord(recType, content[:n]); err != nil {
+			return err
+		}
+		content = content[n:]
+	}
+	return f.writeRecord(recType, nil)
+}
+
+func encodeFcgiParams(params map[string]string) []byte {
+	var b bytes.Buffer
+	size := make([]byte, 4)
+	writeSize := func(n int) {
+		if n < 128 {
+			b.WriteByte(byte(n))
+		} else {
+			binary.BigEndian.PutUint32(size, uint32(n)|1<<31)
+			b.Write(size)
+		}
+	}
+	for k, v := range params {
+		writeSize(len(k))
+		writeSize(len(v))
+		b.WriteString(k)
+		b.WriteString(v)
+	}
+	return b.Bytes()
+}
+
+// request send a request with params and stdin, then read the stdout and stderr until end request.
+// the whole request must finish before the deadline, so a hung backend can not hold the connection.
+func (f *fcgiConn) request(params map[string]string, stdin []byte, deadline time.Time) (stdout []byte, stderr []byte, err error) {
+	f.conn.SetDeadline(deadline)
+	begin := []byte{0, fcgiResponder, fcgiKeepConn, 0, 0, 0, 0, 0}
+	if err = f.writeRecord(fcgiBeginRequest, begin); err != nil {
+		return nil, nil, err
+	}
+	if err = f.writeStream(fcgiParams, encodeFcgiParams(params)); err != nil {
+		return nil, nil, err
+	}
+	if err = f.writeStream(fcgiStdin, stdin); err != nil {
+		return nil, nil, err
+	}
+	var out, errOut bytes.Buffer
+	header := make([]byte, fcgiHeaderLen)
+	for {
+		if _, err = io.ReadFull(f.reader, header); err != nil {
+			return nil, nil, err
+		}
+		contentLen := int64(binary.BigEndian.Uint16(header[4:]))
+		switch header[1] {
+		case fcgiStdout:
+			_, err = io.CopyN(&out, f.reader, contentLen)
+		case fcgiStderr:
+			_, err = io.CopyN(&errOut, f.reader, contentLen)
+		default:
+			_, err = io.CopyN(ioutil.Discard, f.reader, contentLen)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err = io.CopyN(ioutil.Discard, f.reader, int64(header[6])); err != nil { // padding
+			return nil, nil, err
+		}
+		if header[1] == fcgiEndRequest {
+			return out.Bytes(), errOut.Bytes(), nil
+		}
+	}
+}
+
+// stale returns whether an idle connection is closed by backend or has unexpected data
+func (f *fcgiConn) stale() bool {
+	if f.reader.Buffered() > 0 {
+		return true
+	}
+	f.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := f.reader.Peek(1)
+	f.conn.SetReadDeadline(time.Time{})
+	ne, ok := err.(net.Error)
+	return !ok || !ne.Timeout()
+}
+
+// fcgiPool keeps FastCGI connections alive between requests, so requests do not wait for connecting to the backend.
+// an idle connection closed by backend is dropped before use. pools are shared by cgi providers with the same
+// backend address and pool settings.
+type fcgiPool struct {
+	key     string
+	timeout time.Duration
+	dial    func(timeout time.Duration) (net.Conn, error)
+	idle    chan *fcgiConn
+	refs    int
+	closed  bool
+	lock    sync.Mutex
+}
+
+var (
+	fcgiPools    = make(map[string]*fcgiPool)
+	fcgiPoolLock sync.Mutex
+)
+
+// getFcgiPool get the shared pool of the backend and settings. the pool should be released by releaseFcgiPool when it is not used.
+func getFcgiPool(host string, port int, maxIdle int, timeout time.Duration) *fcgiPool {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	key := addr + "?maxIdle=" + strconv.Itoa(maxIdle) + "&timeout=" + timeout.String()
+	fcgiPoolLock.Lock()
+	defer fcgiPoolLock.Unlock()
+	pool := fcgiPools[key]
+	if pool == nil {
+		pool = newFcgiPool(key, maxIdle, timeout, func(timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, timeout)
+		})
+		fcgiPools[key] = pool
+	}
+	pool.refs++
+	return pool
+}
+
+func newFcgiPool(key string, maxIdle int, timeout time.Duration, dial func(timeout time.Duration) (net.Conn, error)) *fcgiPool {
+	return &fcgiPool{key: key, timeout: timeout, dial: dial, idle: make(chan *fcgiConn, maxIdle)}
+}
+
+func releaseFcgiPool(pool *fcgiPool) {
+	fcgiPoolLock.Lock()
+	defer fcgiPoolLock.Unlock()
+	pool.refs--
+	if pool.refs <= 0 {
+		if fcgiPools[pool.key] == pool {
+			delete(fcgiPools, pool.key)
+		}
+		pool.close()
+	}
+}
+
+// get returns a live idle connection, or connects a new one before the deadline
+func (p *fcgiPool) get(deadline time.Time) (*fcgiConn, error) {
+	for {
+		select {
+		case c := <-p.idle:
+			if !c.stale() {
+				return c, nil
+			}
+			c.conn.Close()
+			continue
+		default:
+		}
+		break
+	}
+	p.lock.Lock()
+	closed := p.closed
+	p.lock.Unlock()
+	if closed {
+		return nil, errFcgiPoolClosed
+	}
+	conn, err := p.dial(deadline.Sub(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	return &fcgiConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// put return the connection to pool. the connection is closed if request fail or pool is full
+func (p *fcgiPool) put(c *fcgiConn, err error) {
+	if err == nil {
+		c.conn.SetDeadline(time.Time{})
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if !p.closed {
+			select {
+			case p.idle <- c:
+				return
+			default:
+			}
+		}
+	}
+	c.conn.Close()
+}
+
+// request process a request by a pooled connection in timeout. the request is never retried, because a failed
+// connection can not tell whether the request is processed by the backend.
+func (p *fcgiPool) request(env map[string]string, reqStr string) ([]byte, []byte, error) {
+	deadline := time.Now().Add(p.timeout)
+	c, err := p.get(deadline)
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, stderr, err := c.request(env, []byte(reqStr), deadline)
+	p.put(c, err)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil, nil, errFcgiTimeout
+	}
+	return stdout, stderr, err
+}
+
+// close closes the idle connections, connections in use are closed when they are put back
+func (p *fcgiPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for {
+		select {
+		case c := <-p.idle:
+			c.conn.Close()
+		default:
+			return
+		}
+	}
+}
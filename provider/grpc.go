@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+	"golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	metadata "google.golang.org/grpc/metadata"
+)
+
+// grpc provider settings from service url
+const (
+	GRPCHostKey    = "GRPC_HOST"
+	GRPCPortKey    = "GRPC_PORT"
+	GRPCServiceKey = "GRPC_SERVICE" // full name of the grpc service, default is the path of motan service
+	GRPCTimeoutKey = "GRPC_TIMEOUT" // request timeout in millisecond
+)
+
+const (
+	DefaultGRPCHost    = "127.0.0.1"
+	DefaultGRPCPort    = 50051
+	defaultGRPCTimeout = 1000
+
+	// GRPCSerialNum is the serialization number of protobuf bytes, it is same as the grpc endpoint
+	GRPCSerialNum = 1
+)
+
+// GrpcProvider forwards motan requests to a local grpc server.
+// the argument of request is passed to grpc server as the raw protobuf bytes of grpc request,
+// and the raw bytes of grpc reply is returned without serialization.
+type GrpcProvider struct {
+	url      *motan.URL
+	service  string
+	timeout  time.Duration
+	grpcConn *grpc.ClientConn
+}
+
+func (g *GrpcProvider) Initialize() {
+	host := g.url.GetParam(GRPCHostKey, DefaultGRPCHost)
+	port := int(g.url.GetPositiveIntValue(GRPCPortKey, DefaultGRPCPort))
+	g.service = g.url.GetParam(GRPCServiceKey, g.url.Path)
+	g.timeout = time.Duration(g.url.GetPositiveIntValue(GRPCTimeoutKey, defaultGRPCTimeout)) * time.Millisecond
+	conn, err := grpc.Dial(net.JoinHostPort(host, strconv.Itoa(port)), grpc.WithInsecure(), grpc.WithCodec(&passthroughCodec{}))
+	if err != nil {
+		vlog.Errorf("connect to grpc server fail! url:%s, err:%s\n", g.url.GetIdentity(), err.Error())
+		return
+	}
+	g.grpcConn = conn
+}
+
+func (g *GrpcProvider) SetService(s interface{}) {}
+
+func (g *GrpcProvider) GetURL() *motan.URL {
+	return g.url
+}
+
+func (g *GrpcProvider) SetURL(url *motan.URL) {
+	g.url = url
+}
+
+func (g *GrpcProvider) GetPath() string {
+	return g.url.Path
+}
+
+// IsAvailable returns false if the connection to grpc server fails or is closed.
+// an idle or connecting connection is regarded as available, because it is connected on demand.
+func (g *GrpcProvider) IsAvailable() bool {
+	if g.grpcConn == nil {
+		return false
+	}
+	state := g.grpcConn.GetState()
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+func (g *GrpcProvider) Destroy() {
+	if g.grpcConn != nil {
+		g.grpcConn.Close()
+	}
+}
+
+func (g *GrpcProvider) Call(request motan.Request) motan.Response {
+	t := time.Now().UnixNano()
+	if g.grpcConn == nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 503, ErrMsg: "grpc server is not connected", ErrType: motan.ServiceException})
+	}
+	in, raw, err := grpcArgument(request)
+	if err != nil {
+		vlog.Errorf("grpc provider process argument fail. err:%s, %s\n", err.Error(), motan.GetReqInfo(request))
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: err.Error(), ErrType: motan.ServiceException})
+	}
+
+	var header, trailer metadata.MD
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, grpcMetadata(request.GetAttachments()))
+	out := new(passthroughMsg)
+	err = grpc.Invoke(ctx, "/"+g.service+"/"+request.GetMethod(), in, out, g.grpcConn, grpc.Header(&header), grpc.Trailer(&trailer))
+	resp := &motan.MotanResponse{RequestID: request.GetRequestID(), Attachment: make(map[string]string)}
+	resp.ProcessTime = int64((time.Now().UnixNano() - t) / 1000000)
+	for _, md := range []metadata.MD{header, trailer} {
+		for k, v := range md {
+			if len(v) > 0 {
+				resp.SetAttachment(k, v[0])
+			}
+		}
+	}
+	if err != nil {
+		resp.Exception = grpcStatusException(grpc.Code(err), grpc.ErrorDesc(err))
+		return resp
+	}
+	if raw { // reply with protobuf bytes as same as the request
+		rc := resp.GetRPCContext(true)
+		rc.Serialized = true
+		rc.SerializeNum = GRPCSerialNum
+	}
+	resp.Value = out.buf
+	return resp
+}
+
+// grpcArgument returns the protobuf bytes of request and whether the bytes is raw body of request.
+// the body of proxy request or protobuf request is used directly, otherwise the argument is deserialized as []byte or string.
+func grpcArgument(request motan.Request) ([]byte, bool, error) {
+	args := request.GetArguments()
+	if len(args) == 0 {
+		return []byte{}, true, nil
+	}
+	arg := args[0]
+	if dv, ok := arg.(*motan.DeserializableValue); ok {
+		if dv.Serialization == nil || dv.Serialization.GetSerialNum() == GRPCSerialNum {
+			return dv.Body, true, nil
+		}
+		v, err := dv.Deserialize(nil)
+		if err != nil {
+			return nil, false, err
+		}
+		arg = v
+	}
+	switch v := arg.(type) {
+	case []byte:
+		return v, false, nil
+	case string:
+		return []byte(v), false, nil
+	case nil:
+		return []byte{}, false, nil
+	}
+	return nil, false, errors.New("grpc argument must be []byte")
+}
+
+// grpcMetadata converts attachments to grpc metadata. motan protocol metadata such as path and method are not passed.
+func grpcMetadata(attachments map[string]string) metadata.MD {
+	m := make(map[string]string, len(attachments))
+	for k, v := range attachments {
+		if strings.HasPrefix(k, "M_") {
+			continue
+		}
+		m[k] = v
+	}
+	return metadata.New(m)
+}
+
+// grpcStatusException maps grpc status to motan exception.
+// statuses caused by the request or biz logic are BizException, others are ServiceException.
+func grpcStatusException(code codes.Code, desc string) *motan.Exception {
+	errType := motan.ServiceException
+	switch code {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied, codes.FailedPrecondition,
+		codes.Aborted, codes.OutOfRange, codes.Unauthenticated:
+		errType = motan.BizException
+	}
+	errCode := 500
+	switch code {
+	case codes.Unavailable, codes.ResourceExhausted:
+		errCode = 503
+	case codes.DeadlineExceeded:
+		errCode = 504
+	case codes.NotFound, codes.Unimplemented:
+		errCode = 404
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		errCode = 400
+	case codes.PermissionDenied:
+		errCode = 403
+	case codes.Unauthenticated:
+		errCode = 401
+	case codes.AlreadyExists, codes.Aborted:
+		errCode = 409
+	}
+	return &motan.Exception{ErrCode: errCode, ErrMsg: "grpc status " + strconv.Itoa(int(code)) + ": " + desc, ErrType: errType}
+}
+
+// passthroughCodec sends and receives the raw protobuf bytes without marshaling
+type passthroughCodec struct{}
+
+type passthroughMsg struct {
+	buf []byte
+}
+
+func (passthroughCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return nil, errors.New("passthrough codec can only marshal []byte")
+}
+
+func (passthroughCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(*passthroughMsg)
+	if !ok {
+		return errors.New("passthrough codec can only unmarshal to passthroughMsg")
+	}
+	m.buf = append([]byte(nil), data...)
+	return nil
+}
+
+func (passthroughCodec) String() string {
+	return "passthrough"
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/serialize"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	metadata "google.golang.org/grpc/metadata"
+)
+
+func TestGrpcProvider(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen fail. err:%v", err)
+	}
+	// the grpc server replies the request bytes with prefix, and the uid metadata in header
+	server := grpc.NewServer(grpc.CustomCodec(&passthroughCodec{}), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		in := new(passthroughMsg)
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		if string(in.buf) == "unknown" {
+			return grpc.Errorf(codes.NotFound, "not found")
+		}
+		if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+			stream.SetHeader(metadata.Pairs("uid", md["uid"][0]))
+		}
+		return stream.SendMsg(append([]byte("echo:"), in.buf...))
+	}))
+	go server.Serve(ln)
+	defer server.Stop()
+
+	url := &motan.URL{Path: "com.test.Echo", Parameters: map[string]string{GRPCPortKey: strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)}}
+	provider := &GrpcProvider{url: url}
+	provider.Initialize()
+	defer provider.Destroy()
+	if !provider.IsAvailable() {
+		t.Fatal("provider should be available")
+	}
+	request := &motan.MotanRequest{RequestID: 1, Method: "Echo", Arguments: []interface{}{&motan.DeserializableValue{Body: []byte("hello")}},
+		Attachment: map[string]string{"uid": "123", "M_p": "com.test.Echo"}}
+	res := provider.Call(request)
+	if res.GetException() != nil || string(res.GetValue().([]byte)) != "echo:hello" {
+		t.Fatalf("grpc call fail. res:%+v", res)
+	}
+	if res.GetAttachment("uid") != "123" || !res.GetRPCContext(true).Serialized {
+		t.Fatalf("grpc response not correct. res:%+v", res)
+	}
+	request.Arguments = []interface{}{&motan.DeserializableValue{Body: []byte("unknown")}}
+	if e := provider.Call(request).GetException(); e == nil || e.ErrCode != 404 {
+		t.Fatalf("grpc status should be mapped to exception. exception:%+v", e)
+	}
+
+	server.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for provider.IsAvailable() && time.Now().Before(deadline) {
+		provider.Call(request) // connection is reconnected on demand
+		time.Sleep(10 * time.Millisecond)
+	}
+	if provider.IsAvailable() {
+		t.Fatal("provider should be unavailable when grpc server is down")
+	}
+}
+
+func TestGrpcArgument(t *testing.T) {
+	request := &motan.MotanRequest{Arguments: []interface{}{&motan.DeserializableValue{Body: []byte{1, 2}}}}
+	in, raw, err := grpcArgument(request)
+	if err != nil || !raw || string(in) != string([]byte{1, 2}) {
+		t.Fatalf("proxy body should be passed directly. in:%v, raw:%t, err:%v", in, raw, err)
+	}
+	simple := &serialize.SimpleSerialization{}
+	b, _ := simple.Serialize([]byte{3, 4})
+	request = &motan.MotanRequest{Arguments: []interface{}{&motan.DeserializableValue{Serialization: simple, Body: b}}}
+	in, raw, err = grpcArgument(request)
+	if err != nil || raw || string(in) != string([]byte{3, 4}) {
+		t.Fatalf("serialized argument should be deserialized. in:%v, raw:%t, err:%v", in, raw, err)
+	}
+	if _, _, err = grpcArgument(&motan.MotanRequest{Arguments: []interface{}{1}}); err == nil {
+		t.Fatal("illegal argument should fail")
+	}
+}
+
+func TestGrpcStatusException(t *testing.T) {
+	cases := []struct {
+		code    codes.Code
+		errCode int
+		errType int
+	}{
+		{codes.InvalidArgument, 400, motan.BizException},
+		{codes.NotFound, 404, motan.BizException},
+		{codes.Unavailable, 503, motan.ServiceException},
+		{codes.DeadlineExceeded, 504, motan.ServiceException},
+		{codes.Internal, 500, motan.ServiceException},
+	}
+	for _, c := range cases {
+		e := grpcStatusException(c.code, "desc")
+		if e.ErrCode != c.errCode || e.ErrType != c.errType {
+			t.Fatalf("grpc status mapping not correct. code:%d, exception:%+v", c.code, e)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	motan "github.com/weibocom/motan-go/core"
@@ -11,7 +12,10 @@ import (
 	"net/http"
 	URL "net/url"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,6 +30,16 @@ type HTTPProvider struct {
 	srvURLMap  srvURLMapT
 	gctx       *motan.Context
 	mixVars    []string
+
+	requestMode     string
+	responseMode    string
+	requestHeaders  map[string]bool // nil means all attachments are mapped to headers
+	responseHeaders map[string]bool // nil means all headers are mapped to attachments
+	statusException bool
+	available       int32
+	unhealthyCount  int
+	destroyCh       chan struct{}
+	destroyOnce     sync.Once
 }
 
 const (
@@ -37,11 +51,45 @@ const (
 	MotanRequestHTTPMethodKey = "HTTP_Method"
 )
 
+// http provider settings. settings are read from service url first, then from the
+// http_default_motan_method conf in http-service section.
+const (
+	HTTPTimeoutKey             = "HTTP_TIMEOUT"               // request timeout in millisecond
+	HTTPMaxIdleConnsKey        = "HTTP_MAX_IDLE_CONNS"        // max idle connections to the backend
+	HTTPIdleConnTimeoutKey     = "HTTP_IDLE_CONN_TIMEOUT"     // idle connection timeout in millisecond
+	HTTPRequestModeKey         = "HTTP_REQUEST_MODE"          // form or json
+	HTTPResponseModeKey        = "HTTP_RESPONSE_MODE"         // raw or json
+	HTTPRequestHeadersKey      = "HTTP_REQUEST_HEADERS"       // comma separated attachment keys which are sent as headers
+	HTTPResponseHeadersKey     = "HTTP_RESPONSE_HEADERS"      // comma separated response headers which are returned as attachments
+	HTTPStatusExceptionKey     = "HTTP_STATUS_EXCEPTION"      // convert non 2xx status to exception if true
+	HTTPHealthURLKey           = "HTTP_HEALTH_URL"            // url for health probing, probing is disabled if empty
+	HTTPHealthIntervalKey      = "HTTP_HEALTH_INTERVAL"       // health probing interval in millisecond
+	HTTPHealthFailThresholdKey = "HTTP_HEALTH_FAIL_THRESHOLD" // provider is unavailable after continuous probing failures
+)
+
+// http request and response modes
+const (
+	HTTPModeForm = "form"
+	HTTPModeJSON = "json"
+	HTTPModeRaw  = "raw"
+)
+
+const (
+	defaultHTTPTimeout             = 1000
+	defaultHTTPMaxIdleConns        = 32
+	defaultHTTPIdleConnTimeout     = 90000
+	defaultHTTPHealthInterval      = 3000
+	defaultHTTPHealthFailThreshold = 3
+	maxHTTPErrorMsgLength          = 1024
+)
+
 // Initialize http provider
 func (h *HTTPProvider) Initialize() {
-	h.httpClient = http.Client{Timeout: 1 * time.Second}
 	h.srvURLMap = make(srvURLMapT)
-	urlConf, _ := h.gctx.Config.GetSection("http-service")
+	var urlConf map[interface{}]interface{}
+	if h.gctx != nil && h.gctx.Config != nil {
+		urlConf, _ = h.gctx.Config.GetSection("http-service")
+	}
 	if urlConf != nil {
 		for confID, info := range urlConf {
 			srvConf := make(srvConfT)
@@ -59,10 +107,121 @@ func (h *HTTPProvider) Initialize() {
 			h.srvURLMap[confID.(string)] = srvConf
 		}
 	}
+	h.httpClient = http.Client{
+		Timeout: time.Duration(h.getIntConf(HTTPTimeoutKey, defaultHTTPTimeout)) * time.Millisecond,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        h.getIntConf(HTTPMaxIdleConnsKey, defaultHTTPMaxIdleConns),
+			MaxIdleConnsPerHost: h.getIntConf(HTTPMaxIdleConnsKey, defaultHTTPMaxIdleConns),
+			IdleConnTimeout:     time.Duration(h.getIntConf(HTTPIdleConnTimeoutKey, defaultHTTPIdleConnTimeout)) * time.Millisecond,
+		},
+	}
+	h.requestMode = h.getConf(HTTPRequestModeKey, HTTPModeForm)
+	h.responseMode = h.getConf(HTTPResponseModeKey, HTTPModeRaw)
+	h.requestHeaders = parseHeaderList(h.getConf(HTTPRequestHeadersKey, ""), false)
+	h.responseHeaders = parseHeaderList(h.getConf(HTTPResponseHeadersKey, ""), true)
+	h.statusException, _ = strconv.ParseBool(h.getConf(HTTPStatusExceptionKey, "false"))
+	h.available = 1
+	h.destroyCh = make(chan struct{})
+	if healthURL := h.getConf(HTTPHealthURLKey, ""); healthURL != "" {
+		go h.probeHealth(healthURL, time.Duration(h.getIntConf(HTTPHealthIntervalKey, defaultHTTPHealthInterval))*time.Millisecond,
+			h.getIntConf(HTTPHealthFailThresholdKey, defaultHTTPHealthFailThreshold))
+	}
+}
+
+// getConf get setting from service url, then from the default method conf in http-service section
+func (h *HTTPProvider) getConf(key string, defaultValue string) string {
+	if v := h.url.GetParam(key, ""); v != "" {
+		return v
+	}
+	if defaultConf, ok := h.srvURLMap[h.url.GetParam(motan.URLConfKey, "")][DefaultMotanMethodConfKey]; ok {
+		if v, ok := defaultConf[key]; ok && v != "" {
+			return v
+		}
+	}
+	return defaultValue
+}
+
+func (h *HTTPProvider) getIntConf(key string, defaultValue int) int {
+	v, err := strconv.Atoi(h.getConf(key, ""))
+	if err != nil || v <= 0 {
+		return defaultValue
+	}
+	return v
+}
+
+// parseHeaderList parse comma separated header names. nil is returned if the list is empty, means no restriction.
+// response header names are canonicalized because headers from http response are canonical.
+func parseHeaderList(list string, canonical bool) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	headers := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if canonical {
+				name = http.CanonicalHeaderKey(name)
+			}
+			headers[name] = true
+		}
+	}
+	return headers
+}
+
+// probeHealth request the health url periodically, the provider will be unavailable
+// after continuous failures reach the threshold, and be available again once probing success.
+func (h *HTTPProvider) probeHealth(healthURL string, interval time.Duration, threshold int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.destroyCh:
+			return
+		case <-ticker.C:
+			h.updateHealth(h.checkHealth(healthURL), threshold)
+		}
+	}
+}
+
+func (h *HTTPProvider) checkHealth(healthURL string) bool {
+	resp, err := h.httpClient.Get(healthURL)
+	if err != nil {
+		vlog.Warningf("http provider health check fail. url:%s, err:%v\n", healthURL, err)
+		return false
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		vlog.Warningf("http provider health check fail. url:%s, status:%d\n", healthURL, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
+func (h *HTTPProvider) updateHealth(healthy bool, threshold int) {
+	if healthy {
+		h.unhealthyCount = 0
+		if atomic.CompareAndSwapInt32(&h.available, 0, 1) {
+			vlog.Infof("http provider is available. service:%s\n", h.url.Path)
+		}
+		return
+	}
+	h.unhealthyCount++
+	if h.unhealthyCount >= threshold && atomic.CompareAndSwapInt32(&h.available, 1, 0) {
+		vlog.Warningf("http provider is unavailable. service:%s, fail count:%d\n", h.url.Path, h.unhealthyCount)
+	}
 }
 
 // Destroy a HTTPProvider
 func (h *HTTPProvider) Destroy() {
+	h.destroyOnce.Do(func() {
+		if h.destroyCh != nil {
+			close(h.destroyCh)
+		}
+		if t, ok := h.httpClient.Transport.(*http.Transport); ok {
+			t.CloseIdleConnections()
+		}
+	})
 }
 
 // SetSerialization for set a motan.SetSerialization to HTTPProvider
@@ -184,7 +343,16 @@ func (h *HTTPProvider) Call(request motan.Request) motan.Response {
 		return resp
 	}
 	var reqBody io.Reader
-	if httpReqMethod == "GET" {
+	contentType := ""
+	if h.requestMode == HTTPModeJSON && httpReqMethod != "GET" {
+		body, err := buildJSONBody(request)
+		if err != nil {
+			fillException(resp, t, err)
+			return resp
+		}
+		reqBody = bytes.NewReader(body)
+		contentType = "application/json"
+	} else if httpReqMethod == "GET" {
 		httpReqURL = httpReqURL + "?" + queryStr
 	} else if httpReqMethod == "POST" {
 		data, err := URL.ParseQuery(queryStr)
@@ -192,6 +360,7 @@ func (h *HTTPProvider) Call(request motan.Request) motan.Response {
 			vlog.Errorf("new HTTP Provider ParseQuery err: %v", err)
 		}
 		reqBody = strings.NewReader(data.Encode())
+		contentType = "application/x-www-form-urlencoded"
 	}
 	req, err := http.NewRequest(httpReqMethod, httpReqURL, reqBody)
 	if err != nil {
@@ -199,7 +368,13 @@ func (h *HTTPProvider) Call(request motan.Request) motan.Response {
 		fillException(resp, t, err)
 		return resp
 	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 	for k, v := range request.GetAttachments() {
+		if h.requestHeaders != nil && !h.requestHeaders[k] {
+			continue
+		}
 		k = strings.Replace(k, "M_", "MOTAN-", -1)
 		req.Header.Add(k, v)
 	}
@@ -237,12 +412,77 @@ func (h *HTTPProvider) Call(request motan.Request) motan.Response {
 		resp.SetAttachment(k, v)
 	}
 	for k, v := range headers {
+		if h.responseHeaders != nil && !h.responseHeaders[k] {
+			continue
+		}
 		resp.SetAttachment(k, v[0])
 	}
+	if h.statusException && (statusCode < 200 || statusCode >= 300) {
+		resp.Exception = buildStatusException(statusCode, body)
+		return resp
+	}
+	if h.responseMode == HTTPModeJSON {
+		value, err := parseJSONResponse(body)
+		if err != nil {
+			vlog.Warningf("http provider response is not json. url:%s, err:%v\n", httpReqURL, err)
+			resp.Exception = &motan.Exception{ErrCode: 500, ErrMsg: "response is not json: " + err.Error(), ErrType: motan.ServiceException}
+			return resp
+		}
+		resp.Value = value
+		return resp
+	}
 	resp.Value = string(body)
 	return resp
 }
 
+// buildJSONBody use the first argument as json body. string and []byte arguments are sent as it is, and
+// other arguments are marshaled to json.
+func buildJSONBody(request motan.Request) ([]byte, error) {
+	args := request.GetArguments()
+	if len(args) == 0 || args[0] == nil {
+		return nil, nil
+	}
+	switch v := args[0].(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// parseJSONResponse check the response body is json. json object with only string values is returned as map[string]string,
+// other json is returned as string.
+func parseJSONResponse(body []byte) (interface{}, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if json.Unmarshal(body, &m) == nil && m != nil {
+		return m, nil
+	}
+	return string(body), nil
+}
+
+// buildStatusException convert non 2xx status to exception. 5xx and 429 are service exceptions which can be retried,
+// other status are biz exceptions.
+func buildStatusException(statusCode int, body []byte) *motan.Exception {
+	errType := motan.BizException
+	if statusCode >= 500 || statusCode == http.StatusTooManyRequests {
+		errType = motan.ServiceException
+	}
+	msg := string(body)
+	if len(msg) > maxHTTPErrorMsgLength {
+		msg = msg[:maxHTTPErrorMsgLength]
+	}
+	if msg == "" {
+		msg = http.StatusText(statusCode)
+	}
+	return &motan.Exception{ErrCode: statusCode, ErrMsg: msg, ErrType: errType}
+}
+
 // GetName return this provider name
 func (h *HTTPProvider) GetName() string {
 	return "HTTPProvider"
@@ -268,10 +508,9 @@ func (h *HTTPProvider) SetMixVars(mixVars []string) {
 	h.mixVars = mixVars
 }
 
-// IsAvailable to check if this provider is sitll working well
+// IsAvailable to check if this provider is sitll working well. it is always true if health probing is disabled
 func (h *HTTPProvider) IsAvailable() bool {
-	//TODO Provider 是否可用
-	return true
+	return atomic.LoadInt32(&h.available) == 1
 }
 
 // SetService to set services to this provider that wich can handle
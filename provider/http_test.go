@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+func TestHTTPProviderCall(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("X-Allowed", "yes")
+			w.Header().Set("X-Other", "no")
+			w.Write([]byte(`{"body":` + string(body) + `,"uid":"` + r.Header.Get("uid") + `","secret":"` + r.Header.Get("secret") + `"}`))
+		case "/error":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad param"))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backend.Close()
+
+	url := &motan.URL{Path: "test.http", Parameters: map[string]string{
+		"URL_FORMAT":           backend.URL + "/%s",
+		"HTTP_REQUEST_METHOD":  "POST",
+		HTTPRequestModeKey:     HTTPModeJSON,
+		HTTPResponseModeKey:    HTTPModeJSON,
+		HTTPRequestHeadersKey:  "uid",
+		HTTPResponseHeadersKey: "x-allowed",
+		HTTPStatusExceptionKey: "true",
+	}}
+	provider := &HTTPProvider{url: url}
+	provider.Initialize()
+	defer provider.Destroy()
+
+	request := &motan.MotanRequest{RequestID: 1, Method: "json", Arguments: []interface{}{`"hello"`}, Attachment: map[string]string{"uid": "123", "secret": "x"}}
+	res := provider.Call(request)
+	if res.GetException() != nil {
+		t.Fatalf("call json fail. exception:%+v", res.GetException())
+	}
+	value, ok := res.GetValue().(map[string]string)
+	if !ok || value["body"] != "hello" || value["uid"] != "123" || value["secret"] != "" {
+		t.Fatalf("json response not correct. value:%+v", res.GetValue())
+	}
+	if res.GetAttachment("X-Allowed") != "yes" || res.GetAttachment("X-Other") != "" {
+		t.Fatalf("response headers not filtered. attachments:%+v", res.GetAttachments())
+	}
+
+	res = provider.Call(&motan.MotanRequest{RequestID: 2, Method: "error", Attachment: map[string]string{}})
+	if res.GetException() == nil || res.GetException().ErrType != motan.BizException || res.GetException().ErrCode != 400 || res.GetException().ErrMsg != "bad param" {
+		t.Fatalf("4xx status should be biz exception. res:%+v", res)
+	}
+	res = provider.Call(&motan.MotanRequest{RequestID: 3, Method: "unknown", Attachment: map[string]string{}})
+	if res.GetException() == nil || res.GetException().ErrType != motan.ServiceException || res.GetException().ErrCode != 502 {
+		t.Fatalf("5xx status should be service exception. res:%+v", res)
+	}
+}
+
+func TestHTTPProviderHealth(t *testing.T) {
+	var healthy int32 = 1
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	url := &motan.URL{Path: "test.http", Parameters: map[string]string{
+		HTTPHealthURLKey:           backend.URL + "/health",
+		HTTPHealthIntervalKey:      "10",
+		HTTPHealthFailThresholdKey: "2",
+	}}
+	provider := &HTTPProvider{url: url}
+	provider.Initialize()
+	defer provider.Destroy()
+	if !provider.IsAvailable() {
+		t.Fatal("provider should be available after initialize")
+	}
+	atomic.StoreInt32(&healthy, 0)
+	time.Sleep(100 * time.Millisecond)
+	if provider.IsAvailable() {
+		t.Fatal("provider should be unavailable after health check fail")
+	}
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(100 * time.Millisecond)
+	if !provider.IsAvailable() {
+		t.Fatal("provider should be available after health check recover")
+	}
+}
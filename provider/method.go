@@ -0,0 +1,225 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/serialize"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// CodedError is an error with a biz error code. error returned by service method which implements
+// this interface will use the code as ErrCode of the BizException, otherwise the ErrCode is 500.
+type CodedError interface {
+	error
+	ErrCode() int
+}
+
+type requestContextKey struct{}
+
+// RequestFromContext returns the motan request of the context passed to service method,
+// so the method can read attachments of the request.
+func RequestFromContext(ctx context.Context) motan.Request {
+	if ctx == nil {
+		return nil
+	}
+	request, _ := ctx.Value(requestContextKey{}).(motan.Request)
+	return request
+}
+
+// methodType describes the signature of a service method.
+// the leading context.Context parameter and the trailing error return value are not included in args and reply.
+type methodType struct {
+	method     reflect.Value
+	hasContext bool
+	hasError   bool
+	args       []reflect.Type // for variadic method, the last arg is the slice type
+	reply      reflect.Type   // nil if method has no reply value
+	checkReply bool           // whether the type of reply value should be checked for simple serialization
+}
+
+func newMethodType(m reflect.Value) *methodType {
+	t := m.Type()
+	mt := &methodType{method: m}
+	start := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		mt.hasContext = true
+		start = 1
+	}
+	for i := start; i < t.NumIn(); i++ {
+		mt.args = append(mt.args, t.In(i))
+	}
+	outNum := t.NumOut()
+	if outNum > 0 && t.Out(outNum-1) == errorType {
+		mt.hasError = true
+		outNum--
+	}
+	if outNum > 0 { // only use first return value.
+		mt.reply = t.Out(0)
+	}
+	return mt
+}
+
+func (m *methodType) isVariadic() bool {
+	return m.method.Type().IsVariadic()
+}
+
+// argTypes returns the pointers of arguments for deserialization. nil is returned for variadic method,
+// so serialization will deserialize all arguments.
+func (m *methodType) argTypes() []interface{} {
+	if m.isVariadic() {
+		return nil
+	}
+	values := make([]interface{}, 0, len(m.args))
+	for _, t := range m.args {
+		values = append(values, reflect.New(t).Interface())
+	}
+	return values
+}
+
+// info returns the method info for service catalog. the last arg of variadic method is described as '...T'
+func (m *methodType) info(name string) motan.MethodInfo {
+	info := motan.MethodInfo{Name: name, Args: make([]string, 0, len(m.args))}
+	for i, t := range m.args {
+		if i == len(m.args)-1 && m.isVariadic() {
+			info.Args = append(info.Args, "..."+t.Elem().String())
+		} else {
+			info.Args = append(info.Args, t.String())
+		}
+	}
+	if m.reply != nil {
+		info.Reply = m.reply.String()
+	}
+	return info
+}
+
+// buildIn converts arguments to the parameter values of method
+func (m *methodType) buildIn(request motan.Request) ([]reflect.Value, error) {
+	args := request.GetArguments()
+	fixed := len(m.args)
+	if m.isVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, fmt.Errorf("arguments count not match. expect at least %d, real %d", fixed, len(args))
+		}
+	} else if len(args) != fixed {
+		return nil, fmt.Errorf("arguments count not match. expect %d, real %d", fixed, len(args))
+	}
+	in := make([]reflect.Value, 0, len(args)+1)
+	if m.hasContext {
+		in = append(in, reflect.ValueOf(context.WithValue(context.Background(), requestContextKey{}, request)))
+	}
+	for i, arg := range args {
+		var t reflect.Type
+		if i < fixed {
+			t = m.args[i]
+		} else {
+			t = m.args[fixed].Elem() // variadic elem type
+		}
+		v, err := convertArg(arg, t)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i, err.Error())
+		}
+		in = append(in, v)
+	}
+	return in, nil
+}
+
+// buildResponse converts the return values of method to response
+func (m *methodType) buildResponse(request motan.Request, ret []reflect.Value) motan.Response {
+	mres := &motan.MotanResponse{RequestID: request.GetRequestID()}
+	if m.hasError {
+		if err, _ := ret[len(ret)-1].Interface().(error); err != nil {
+			code := 500
+			if ce, ok := err.(CodedError); ok {
+				code = ce.ErrCode()
+			}
+			return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: code, ErrMsg: err.Error(), ErrType: motan.BizException})
+		}
+	}
+	if m.reply != nil {
+		mres.Value = ret[0].Interface()
+		if m.checkReply && mres.Value != nil && !serialize.IsSimpleType(reflect.TypeOf(mres.Value)) {
+			return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500,
+				ErrMsg: "reply type " + reflect.TypeOf(mres.Value).String() + " can not be encoded by simple serialization", ErrType: motan.ServiceException})
+		}
+	}
+	return mres
+}
+
+// convertArg converts a deserialized argument to type t. string argument can be parsed to number or bool type.
+func convertArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type().AssignableTo(t) {
+		return v.Elem(), nil
+	}
+	if t.Kind() == reflect.Ptr {
+		e, err := convertArg(arg, t.Elem())
+		if err != nil {
+			return e, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(e)
+		return p, nil
+	}
+	if v.Kind() == t.Kind() && v.Type().ConvertibleTo(t) { // named types, e.g. type Name string
+		return v.Convert(t), nil
+	}
+	if (v.Kind() == reflect.String && isByteSlice(t)) || (isByteSlice(v.Type()) && t.Kind() == reflect.String) {
+		return v.Convert(t), nil
+	}
+	if v.Kind() == reflect.String {
+		return parseString(v.String(), t)
+	}
+	return reflect.Value{}, fmt.Errorf("can not convert %s to %s", v.Type().String(), t.String())
+}
+
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+func parseString(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	default:
+		return v, fmt.Errorf("can not convert string to %s", t.String())
+	}
+	return v, nil
+}
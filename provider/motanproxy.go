@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"errors"
+
+	"github.com/weibocom/motan-go/cluster"
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// motan proxy provider settings from service url
+const (
+	ProxyReferKey    = "proxyRefer"    // id of the refer in motan-refer config which describes the remote service
+	ProxyRegistryKey = "proxyRegistry" // registries to discover the remote service if proxyRefer is not set
+	ProxyProtocolKey = "proxyProtocol" // protocol of the remote service if proxyRefer is not set, default is motan2
+)
+
+// MotanProxyProvider re-exports a service of remote motan servers, e.g. servers in another idc.
+// requests are forwarded by a MotanCluster in proxy mode, so the request body and attachments are passed through,
+// and the cluster, ha and lb settings of the refer are used.
+type MotanProxyProvider struct {
+	url        *motan.URL
+	context    *motan.Context
+	extFactory motan.ExtentionFactory
+	cluster    *cluster.MotanCluster
+}
+
+func (m *MotanProxyProvider) Initialize() {
+	if m.context == nil || m.extFactory == nil {
+		vlog.Errorf("can not init motan proxy provider without context and ext factory. url:%s\n", m.url.GetIdentity())
+		return
+	}
+	referURL, err := m.buildReferURL()
+	if err != nil {
+		vlog.Errorf("can not init motan proxy provider. url:%s, err:%s\n", m.url.GetIdentity(), err.Error())
+		return
+	}
+	c := cluster.NewCluster(referURL, true)
+	c.SetExtFactory(m.extFactory)
+	c.Context = m.context
+	c.InitCluster()
+	m.cluster = c
+	vlog.Infof("motan proxy provider init. service:%s, refer:%s\n", m.url.GetIdentity(), referURL.GetIdentity())
+}
+
+// buildReferURL returns a copy of the refer of proxyRefer, or builds a refer from the service url with proxyRegistry.
+// the registries of service are not used to avoid discovering the service itself.
+func (m *MotanProxyProvider) buildReferURL() (*motan.URL, error) {
+	if id := m.url.GetParam(ProxyReferKey, ""); id != "" {
+		referURL, ok := m.context.RefersURLs[id]
+		if !ok {
+			return nil, errors.New("refer not found: " + id)
+		}
+		return referURL.Copy(), nil
+	}
+	registry := m.url.GetParam(ProxyRegistryKey, "")
+	if registry == "" {
+		return nil, errors.New(ProxyReferKey + " or " + ProxyRegistryKey + " must be set")
+	}
+	referURL := m.url.Copy()
+	referURL.Protocol = m.url.GetParam(ProxyProtocolKey, "motan2")
+	referURL.Host = ""
+	referURL.Port = 0
+	referURL.PutParam(motan.RegistryKey, registry)
+	// filters of the service are used by the exporter already
+	delete(referURL.Parameters, motan.FilterKey)
+	delete(referURL.Parameters, motan.ExportKey)
+	return referURL, nil
+}
+
+func (m *MotanProxyProvider) SetContext(context *motan.Context) {
+	m.context = context
+}
+
+func (m *MotanProxyProvider) SetExtFactory(factory motan.ExtentionFactory) {
+	m.extFactory = factory
+}
+
+func (m *MotanProxyProvider) SetService(s interface{}) {}
+
+func (m *MotanProxyProvider) GetURL() *motan.URL {
+	return m.url
+}
+
+func (m *MotanProxyProvider) SetURL(url *motan.URL) {
+	m.url = url
+}
+
+func (m *MotanProxyProvider) GetPath() string {
+	return m.url.Path
+}
+
+func (m *MotanProxyProvider) IsAvailable() bool {
+	return m.cluster != nil && m.cluster.IsAvailable()
+}
+
+func (m *MotanProxyProvider) Call(request motan.Request) motan.Response {
+	if m.cluster == nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 503, ErrMsg: "motan proxy provider is not initialized. service:" + m.url.Path, ErrType: motan.ServiceException})
+	}
+	res := m.cluster.Call(request)
+	if res == nil {
+		vlog.Warningf("motan proxy cluster call return nil. %s\n", motan.GetReqInfo(request))
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "motan proxy cluster call return nil", ErrType: motan.ServiceException})
+	}
+	return res
+}
+
+func (m *MotanProxyProvider) Destroy() {
+	if m.cluster != nil {
+		m.cluster.Destroy()
+	}
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/endpoint"
+	"github.com/weibocom/motan-go/ha"
+	"github.com/weibocom/motan-go/lb"
+	"github.com/weibocom/motan-go/registry"
+)
+
+func TestMotanProxyProvider(t *testing.T) {
+	ext := &motan.DefaultExtentionFactory{}
+	ext.Initialize()
+	ha.RegistDefaultHa(ext)
+	lb.RegistDefaultLb(ext)
+	registry.RegistDefaultRegistry(ext)
+	endpoint.RegistDefaultEndpoint(ext)
+	context := &motan.Context{RegistryURLs: map[string]*motan.URL{
+		"remote": {Protocol: registry.Direct, Host: "10.0.0.1", Port: 8002},
+	}}
+	url := &motan.URL{Protocol: Motan2Proxy, Path: "test.service", Group: "test-group", Parameters: map[string]string{
+		ProxyRegistryKey:  "remote",
+		ProxyProtocolKey:  endpoint.Mock,
+		motan.RegistryKey: "local",
+		motan.Hakey:       "failover",
+		motan.Lbkey:       "random",
+	}}
+	provider := &MotanProxyProvider{url: url}
+	motan.CanSetContext(provider, context)
+	motan.CanSetExtFactory(provider, ext)
+	provider.Initialize()
+	defer provider.Destroy()
+	if !provider.IsAvailable() {
+		t.Fatal("motan proxy provider should be available")
+	}
+	if refers := provider.cluster.GetRefers(); len(refers) != 1 || refers[0].GetURL().Host != "10.0.0.1" {
+		t.Fatalf("refers of proxy cluster not correct. refers:%+v", refers)
+	}
+	res := provider.Call(&motan.MotanRequest{RequestID: 1, ServiceName: "test.service", Method: "hello", Attachment: make(map[string]string)})
+	if res.GetException() != nil || res.GetValue() != "ok" {
+		t.Fatalf("call motan proxy provider fail. res:%+v", res)
+	}
+
+	notInit := &MotanProxyProvider{url: &motan.URL{Path: "test.service", Parameters: map[string]string{}}}
+	motan.CanSetContext(notInit, context)
+	motan.CanSetExtFactory(notInit, ext)
+	notInit.Initialize()
+	if notInit.IsAvailable() || notInit.Call(&motan.MotanRequest{}).GetException() == nil {
+		t.Fatal("motan proxy provider without refer should not be available")
+	}
+}
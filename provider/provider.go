@@ -3,17 +3,22 @@ package provider
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
+	"github.com/weibocom/motan-go/serialize"
 )
 
 // ext name
 const (
-	CGI     = "cgi"
-	HTTP    = "http"
-	Mock    = "mockProvider"
-	Default = "default"
+	CGI         = "cgi"
+	HTTP        = "http"
+	GRPC        = "grpc"
+	Motan2Proxy = "motan2proxy"
+	Stub        = "stub"
+	Mock        = "mockProvider"
+	Default     = "default"
 )
 
 func RegistDefaultProvider(extFactory motan.ExtentionFactory) {
@@ -26,6 +31,18 @@ func RegistDefaultProvider(extFactory motan.ExtentionFactory) {
 		return &HTTPProvider{url: url}
 	})
 
+	extFactory.RegistExtProvider(GRPC, func(url *motan.URL) motan.Provider {
+		return &GrpcProvider{url: url}
+	})
+
+	extFactory.RegistExtProvider(Motan2Proxy, func(url *motan.URL) motan.Provider {
+		return &MotanProxyProvider{url: url}
+	})
+
+	extFactory.RegistExtProvider(Stub, func(url *motan.URL) motan.Provider {
+		return &StubProvider{url: url}
+	})
+
 	extFactory.RegistExtProvider(Mock, func(url *motan.URL) motan.Provider {
 		return &MockProvider{URL: url}
 	})
@@ -37,22 +54,31 @@ func RegistDefaultProvider(extFactory motan.ExtentionFactory) {
 
 type DefaultProvider struct {
 	service interface{}
-	methods map[string]reflect.Value
+	methods map[string]*methodType
 	url     *motan.URL
 }
 
 func (d *DefaultProvider) Initialize() {
-	d.methods = make(map[string]reflect.Value, 32)
+	d.methods = make(map[string]*methodType, 32)
 	if d.service != nil && d.url != nil {
 		v := reflect.ValueOf(d.service)
 		if v.Kind() != reflect.Ptr {
 			vlog.Errorf("can not init provider. service is not a pointer. service :%v, url:%v\n", d.service, d.url)
 			return
 		}
+		simple := d.url.GetParam(motan.SerializationKey, serialize.Simple) == serialize.Simple
 		for i := 0; i < v.NumMethod(); i++ {
 			name := v.Type().Method(i).Name
-			vm := v.MethodByName(name)
-			d.methods[name] = vm
+			mt := newMethodType(v.MethodByName(name))
+			if simple && mt.reply != nil {
+				// the reply of other types is encoded to empty by simple serialization
+				if mt.reply.Kind() != reflect.Interface && !serialize.IsSimpleType(mt.reply) {
+					vlog.Errorf("method is not provided, reply type %s can not be encoded by simple serialization. method:%s, url:%v\n", mt.reply.String(), name, d.url)
+					continue
+				}
+				mt.checkReply = mt.reply.Kind() == reflect.Interface
+			}
+			d.methods[name] = mt
 		}
 
 	} else {
@@ -82,6 +108,29 @@ func (d *DefaultProvider) IsAvailable() bool {
 
 func (d *DefaultProvider) Destroy() {}
 
+// GetMethods returns all methods of the service sorted by name
+func (d *DefaultProvider) GetMethods() []motan.MethodInfo {
+	methods := make([]motan.MethodInfo, 0, len(d.methods))
+	for name, m := range d.methods {
+		methods = append(methods, m.info(name))
+	}
+	sort.Sort(methodInfos(methods))
+	return methods
+}
+
+// methodInfos sorts methods by name
+type methodInfos []motan.MethodInfo
+
+func (s methodInfos) Len() int {
+	return len(s)
+}
+func (s methodInfos) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s methodInfos) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
 func (d *DefaultProvider) Call(request motan.Request) (res motan.Response) {
 	m, exit := d.methods[motan.FirstUpper(request.GetMethod())]
 	if !exit {
@@ -95,30 +144,17 @@ func (d *DefaultProvider) Call(request motan.Request) (res motan.Response) {
 		}
 	}()
 
-	inNum := m.Type().NumIn()
-	if inNum > 0 {
-		values := make([]interface{}, 0, inNum)
-		for i := 0; i < inNum; i++ {
-			// TODO how to reflect value pointer???
-			values = append(values, reflect.New(m.Type().In(i)).Type())
-		}
-		err := request.ProcessDeserializable(values)
-		if err != nil {
-			return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "deserialize arguments fail." + err.Error(), ErrType: motan.ServiceException})
-		}
-	}
-
-	vs := make([]reflect.Value, 0, len(request.GetArguments()))
-	for _, arg := range request.GetArguments() {
-		vs = append(vs, reflect.ValueOf(arg))
+	// arguments of zero-arg method will be deserialized to empty, so the redundant arguments are ignored
+	err := request.ProcessDeserializable(m.argTypes())
+	if err != nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "deserialize arguments fail." + err.Error(), ErrType: motan.ServiceException})
 	}
-	ret := m.Call(vs)
-	mres := &motan.MotanResponse{RequestID: request.GetRequestID()}
-	if len(ret) > 0 { // only use first return value.
-		mres.Value = ret[0]
-		res = mres
+	in, err := m.buildIn(request)
+	if err != nil {
+		vlog.Errorf("provider build arguments fail. err:%s, %s\n", err.Error(), motan.GetReqInfo(request))
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "illegal arguments. " + err.Error(), ErrType: motan.ServiceException})
 	}
-	return res
+	return m.buildResponse(request, m.method.Call(in))
 }
 
 type MockProvider struct {
@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/serialize"
+)
+
+type testError struct{}
+
+func (e *testError) Error() string { return "test error" }
+func (e *testError) ErrCode() int  { return 1001 }
+
+type testService struct{}
+
+func (s *testService) Hello(name string) string { return "hello " + name }
+
+func (s *testService) Add(ctx context.Context, a int, b int) (string, error) {
+	if RequestFromContext(ctx).GetAttachment("fail") != "" {
+		return "", errors.New("add fail")
+	}
+	return strconv.Itoa(a + b), nil
+}
+
+func (s *testService) Join(sep string, values ...string) string { return strings.Join(values, sep) }
+
+func (s *testService) Ping() string { return "pong" }
+
+func (s *testService) Fail() error { return &testError{} }
+
+func (s *testService) Count() int { return 1 }
+
+func (s *testService) Any(kind string) interface{} {
+	if kind == "int" {
+		return 1
+	}
+	return kind
+}
+
+func TestDefaultProviderCall(t *testing.T) {
+	provider := &DefaultProvider{url: &motan.URL{Path: "test.service"}}
+	provider.SetService(&testService{})
+	provider.Initialize()
+
+	res := provider.Call(buildRequest(t, "hello", "motan"))
+	if res.GetException() != nil || res.GetValue() != "hello motan" {
+		t.Fatalf("call hello fail. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "add", "1", "2"))
+	if res.GetException() != nil || res.GetValue() != "3" {
+		t.Fatalf("call add fail. res:%+v", res)
+	}
+	request := buildRequest(t, "add", "1", "2")
+	request.SetAttachment("fail", "true")
+	res = provider.Call(request)
+	if res.GetException() == nil || res.GetException().ErrType != motan.BizException || res.GetException().ErrMsg != "add fail" {
+		t.Fatalf("error return should be biz exception. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "add", "x", "2"))
+	if res.GetException() == nil || res.GetException().ErrType != motan.ServiceException {
+		t.Fatalf("illegal argument should be service exception. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "join", ",", "a", "b", "c"))
+	if res.GetException() != nil || res.GetValue() != "a,b,c" {
+		t.Fatalf("call variadic method fail. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "join", ","))
+	if res.GetException() != nil || res.GetValue() != "" {
+		t.Fatalf("call variadic method without variadic arguments fail. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "ping"))
+	if res.GetException() != nil || res.GetValue() != "pong" {
+		t.Fatalf("call zero-arg method fail. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "fail"))
+	if res.GetException() == nil || res.GetException().ErrCode != 1001 || res.GetException().ErrType != motan.BizException {
+		t.Fatalf("coded error should be biz exception with code. res:%+v", res)
+	}
+	// reply which can not be encoded by simple serialization is rejected
+	res = provider.Call(buildRequest(t, "count"))
+	if res.GetException() == nil || res.GetException().ErrType != motan.ServiceException {
+		t.Fatalf("method with int reply should not be provided. res:%+v", res)
+	}
+	for _, m := range provider.GetMethods() {
+		if m.Name == "Count" {
+			t.Fatal("method with int reply should not be listed")
+		}
+	}
+	res = provider.Call(buildRequest(t, "any", "string"))
+	if res.GetException() != nil || res.GetValue() != "string" {
+		t.Fatalf("call interface reply method fail. res:%+v", res)
+	}
+	res = provider.Call(buildRequest(t, "any", "int"))
+	if res.GetException() == nil || res.GetException().ErrType != motan.ServiceException {
+		t.Fatalf("interface reply of int should be service exception. res:%+v", res)
+	}
+}
+
+func buildRequest(t *testing.T, method string, args ...interface{}) motan.Request {
+	request := &motan.MotanRequest{RequestID: 1, ServiceName: "test.service", Method: method, Attachment: make(map[string]string)}
+	if len(args) > 0 {
+		simple := &serialize.SimpleSerialization{}
+		b, err := simple.SerializeMulti(args)
+		if err != nil {
+			t.Fatalf("serialize arguments fail. err:%v", err)
+		}
+		request.Arguments = []interface{}{&motan.DeserializableValue{Serialization: simple, Body: b}}
+	}
+	return request
+}
+
+func TestConvertArg(t *testing.T) {
+	type name string
+	cases := []struct {
+		arg    interface{}
+		target interface{}
+		expect interface{}
+	}{
+		{"motan", name(""), name("motan")},
+		{"12", int64(0), int64(12)},
+		{"true", false, true},
+		{"1.5", float64(0), 1.5},
+		{[]byte("bytes"), "", "bytes"},
+		{"bytes", []byte(nil), "bytes"},
+		{nil, 0, 0},
+	}
+	for _, c := range cases {
+		v, err := convertArg(c.arg, reflect.TypeOf(c.target))
+		if err != nil {
+			t.Fatalf("convert arg fail. arg:%v, err:%v", c.arg, err)
+		}
+		real := v.Interface()
+		if b, ok := real.([]byte); ok {
+			real = string(b)
+		}
+		if real != c.expect {
+			t.Fatalf("convert arg not correct. arg:%v, expect:%v, real:%v", c.arg, c.expect, real)
+		}
+	}
+	if _, err := convertArg("x", reflect.TypeOf(0)); err == nil {
+		t.Fatal("convert illegal number should fail")
+	}
+	if p, err := convertArg("3", reflect.TypeOf(new(int))); err != nil || *(p.Interface().(*int)) != 3 {
+		t.Fatalf("convert to pointer fail. err:%v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+	"gopkg.in/yaml.v2"
+)
+
+// stub provider settings from service url
+const (
+	StubFixtureKey        = "STUB_FIXTURE"         // path of the fixture file. file with .json extension is parsed as json, otherwise yaml
+	StubReloadIntervalKey = "STUB_RELOAD_INTERVAL" // interval in millisecond to check fixture file changes. 0 means no hot reload
+)
+
+const defaultStubReloadInterval = 1000
+
+// stubWildcard matches any method in fixture methods, or any value in match args and attachments
+const stubWildcard = "*"
+
+// StubFixture is the content of fixture file. responses of a method are matched in order,
+// and responses of method "*" are used if no response of the method is matched. e.g.
+//
+//	methods:
+//	  hello:
+//	    - match: {args: ["motan"], attachments: {user: "test"}}
+//	      response: "hello motan"
+//	      latency: 100
+//	    - error: {code: 503, message: "server busy"}
+type StubFixture struct {
+	Methods map[string][]*StubResponse `yaml:"methods" json:"methods"`
+}
+
+// StubResponse is a stub response with the condition to match requests.
+// response value of string or map of strings is returned as it is, other values are returned as json string.
+type StubResponse struct {
+	Match struct {
+		Args        []interface{}     `yaml:"args" json:"args"`               // matched by string form of arguments in order, '*' matches any value
+		Attachments map[string]string `yaml:"attachments" json:"attachments"` // all attachments should be matched
+	} `yaml:"match" json:"match"`
+	Response    interface{}       `yaml:"response" json:"response"`
+	Attachments map[string]string `yaml:"attachments" json:"attachments"` // attachments of response
+	Latency     int               `yaml:"latency" json:"latency"`         // latency in millisecond before response
+	Error       *struct {
+		Code    int    `yaml:"code" json:"code"`
+		Message string `yaml:"message" json:"message"`
+		Type    string `yaml:"type" json:"type"` // 'biz' or 'service', default is 'service'
+	} `yaml:"error" json:"error"`
+}
+
+// StubProvider impersonates a service with responses from a fixture file, so agents can run without downstream services.
+type StubProvider struct {
+	url      *motan.URL
+	file     string
+	fixture  *StubFixture
+	modTime  time.Time
+	lock     sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func (s *StubProvider) Initialize() {
+	s.file = s.url.GetParam(StubFixtureKey, "")
+	s.stopCh = make(chan struct{})
+	if s.file == "" {
+		vlog.Errorf("stub fixture is not set. url:%s\n", s.url.GetIdentity())
+		return
+	}
+	if err := s.load(); err != nil {
+		vlog.Errorf("load stub fixture fail. file:%s, err:%v\n", s.file, err)
+	}
+	if interval := s.url.GetIntValue(StubReloadIntervalKey, defaultStubReloadInterval); interval > 0 {
+		go s.watch(time.Duration(interval) * time.Millisecond)
+	}
+}
+
+// load parses the fixture file. the old fixture is kept if the file is invalid.
+func (s *StubProvider) load() error {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	fixture := &StubFixture{}
+	if filepath.Ext(s.file) == ".json" {
+		err = json.Unmarshal(b, fixture)
+	} else {
+		err = yaml.Unmarshal(b, fixture)
+	}
+	s.lock.Lock()
+	s.modTime = info.ModTime()
+	if err == nil {
+		s.fixture = fixture
+	}
+	s.lock.Unlock()
+	return err
+}
+
+func (s *StubProvider) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(s.file)
+			if err != nil {
+				continue
+			}
+			s.lock.RLock()
+			changed := !info.ModTime().Equal(s.modTime)
+			s.lock.RUnlock()
+			if changed {
+				if err = s.load(); err != nil {
+					vlog.Errorf("reload stub fixture fail. file:%s, err:%v\n", s.file, err)
+				} else {
+					vlog.Infof("stub fixture reloaded. file:%s\n", s.file)
+				}
+			}
+		}
+	}
+}
+
+func (s *StubProvider) SetService(service interface{}) {}
+
+func (s *StubProvider) GetURL() *motan.URL {
+	return s.url
+}
+
+func (s *StubProvider) SetURL(url *motan.URL) {
+	s.url = url
+}
+
+func (s *StubProvider) GetPath() string {
+	return s.url.Path
+}
+
+func (s *StubProvider) IsAvailable() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.fixture != nil
+}
+
+func (s *StubProvider) Destroy() {
+	s.stopOnce.Do(func() {
+		if s.stopCh != nil {
+			close(s.stopCh)
+		}
+	})
+}
+
+func (s *StubProvider) Call(request motan.Request) motan.Response {
+	if err := request.ProcessDeserializable(nil); err != nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "deserialize arguments fail." + err.Error(), ErrType: motan.ServiceException})
+	}
+	sr := s.match(request)
+	if sr == nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 404, ErrMsg: "no stub response for method " + request.GetMethod(), ErrType: motan.ServiceException})
+	}
+	if sr.Latency > 0 {
+		time.Sleep(time.Duration(sr.Latency) * time.Millisecond)
+	}
+	if sr.Error != nil {
+		errType := motan.ServiceException
+		if sr.Error.Type == "biz" {
+			errType = motan.BizException
+		}
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: sr.Error.Code, ErrMsg: sr.Error.Message, ErrType: errType})
+	}
+	value, err := stubValue(sr.Response)
+	if err != nil {
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "stub response is invalid. " + err.Error(), ErrType: motan.ServiceException})
+	}
+	resp := &motan.MotanResponse{RequestID: request.GetRequestID(), Value: value, ProcessTime: int64(sr.Latency), Attachment: make(map[string]string, len(sr.Attachments))}
+	for k, v := range sr.Attachments {
+		resp.SetAttachment(k, v)
+	}
+	return resp
+}
+
+// match returns the first response matched with the request
+func (s *StubProvider) match(request motan.Request) *StubResponse {
+	s.lock.RLock()
+	fixture := s.fixture
+	s.lock.RUnlock()
+	if fixture == nil {
+		return nil
+	}
+	for _, method := range []string{request.GetMethod(), stubWildcard} {
+		for _, sr := range fixture.Methods[method] {
+			if sr.matches(request) {
+				return sr
+			}
+		}
+	}
+	return nil
+}
+
+func (sr *StubResponse) matches(request motan.Request) bool {
+	if sr.Match.Args != nil {
+		args := request.GetArguments()
+		if len(args) != len(sr.Match.Args) {
+			return false
+		}
+		for i, expect := range sr.Match.Args {
+			if e := fmt.Sprint(expect); e != stubWildcard && e != stubString(args[i]) {
+				return false
+			}
+		}
+	}
+	for k, v := range sr.Match.Attachments {
+		real := request.GetAttachment(k)
+		if (v == stubWildcard && real == "") || (v != stubWildcard && v != real) {
+			return false
+		}
+	}
+	return true
+}
+
+func stubString(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// stubValue converts the response value of fixture to the value which can be serialized
+func stubValue(v interface{}) (interface{}, error) {
+	switch rv := v.(type) {
+	case nil, string:
+		return rv, nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		m := make(map[string]string)
+		simple := true
+		normalized := normalizeStubValue(rv).(map[string]interface{})
+		for k, e := range normalized {
+			s, ok := e.(string)
+			if !ok {
+				simple = false
+				break
+			}
+			m[k] = s
+		}
+		if simple {
+			return m, nil
+		}
+		v = normalized
+	}
+	b, err := json.Marshal(normalizeStubValue(v))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// normalizeStubValue converts maps decoded by yaml to map[string]interface{}, so they can be marshaled to json
+func normalizeStubValue(v interface{}) interface{} {
+	switch rv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(rv))
+		for k, e := range rv {
+			m[fmt.Sprint(k)] = normalizeStubValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(rv))
+		for k, e := range rv {
+			m[k] = normalizeStubValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(rv))
+		for _, e := range rv {
+			l = append(l, normalizeStubValue(e))
+		}
+		return l
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+const testFixture = `
+methods:
+  hello:
+    - match: {args: ["motan"], attachments: {user: "*"}}
+      response: "hello user"
+      attachments: {stub: "true"}
+    - match: {args: ["motan"]}
+      response: "hello motan"
+      latency: 20
+  profile:
+    - response: {name: "motan", age: 8}
+  "*":
+    - error: {code: 503, message: "server busy", type: "biz"}
+`
+
+func TestStubProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stub")
+	if err != nil {
+		t.Fatalf("create temp dir fail. err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "fixture.yaml")
+	if err = ioutil.WriteFile(file, []byte(testFixture), 0644); err != nil {
+		t.Fatalf("write fixture fail. err:%v", err)
+	}
+	provider := &StubProvider{url: &motan.URL{Path: "test.service", Parameters: map[string]string{StubFixtureKey: file, StubReloadIntervalKey: "10"}}}
+	provider.Initialize()
+	defer provider.Destroy()
+	if !provider.IsAvailable() {
+		t.Fatal("stub provider should be available")
+	}
+
+	request := &motan.MotanRequest{Method: "hello", Arguments: []interface{}{"motan"}, Attachment: map[string]string{"user": "test"}}
+	res := provider.Call(request)
+	if res.GetValue() != "hello user" || res.GetAttachment("stub") != "true" {
+		t.Fatalf("attachment matched response not correct. res:%+v", res)
+	}
+	start := time.Now()
+	res = provider.Call(&motan.MotanRequest{Method: "hello", Arguments: []interface{}{"motan"}})
+	if res.GetValue() != "hello motan" || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("args matched response not correct. res:%+v", res)
+	}
+	res = provider.Call(&motan.MotanRequest{Method: "profile"})
+	if res.GetValue() != `{"age":8,"name":"motan"}` {
+		t.Fatalf("json response not correct. res:%+v", res)
+	}
+	res = provider.Call(&motan.MotanRequest{Method: "hello", Arguments: []interface{}{"other"}})
+	if res.GetException() == nil || res.GetException().ErrCode != 503 || res.GetException().ErrType != motan.BizException {
+		t.Fatalf("wildcard error response not correct. res:%+v", res)
+	}
+
+	if err = ioutil.WriteFile(file, []byte("methods: {hello: [{response: reloaded}]}"), 0644); err != nil {
+		t.Fatalf("write fixture fail. err:%v", err)
+	}
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if res = provider.Call(&motan.MotanRequest{Method: "hello"}); res.GetValue() == "reloaded" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("fixture should be reloaded. res:%+v", res)
+}
@@ -27,11 +27,22 @@ const (
 	ZkNodetypeAgent             = "agent"
 )
 
+// ZkConn is the zookeeper operations used by ZkRegistry, it is implemented by *zk.Conn
+type ZkConn interface {
+	Exists(path string) (bool, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+}
+
 type ZkRegistry struct {
 	url            *motan.URL
 	timeout        time.Duration
 	sessionTimeout time.Duration
-	zkConn         *zk.Conn
+	zkConn         ZkConn
 	nodeRs         map[string]ServiceNode
 
 	subscribeMap     map[string]map[string]motan.NotifyListener
@@ -40,6 +51,15 @@ type ZkRegistry struct {
 	registryLock     sync.Mutex
 
 	watchSwitcherMap map[string]chan bool
+
+	servicesLock sync.Mutex
+	services     map[string]*motan.URL // registered service nodes
+}
+
+// NewZkRegistry returns a registry on an established zookeeper connection, snapshot is not started.
+func NewZkRegistry(url *motan.URL, conn ZkConn) *ZkRegistry {
+	return &ZkRegistry{url: url, zkConn: conn, subscribeMap: make(map[string]map[string]motan.NotifyListener),
+		nodeRs: make(map[string]ServiceNode), watchSwitcherMap: make(map[string]chan bool)}
 }
 
 func (z *ZkRegistry) Initialize() {
@@ -179,10 +199,25 @@ func (z *ZkRegistry) Register(url *motan.URL) {
 	} else {
 		vlog.Infof("register sucesss, service:%s\n", url.GetIdentity())
 	}
+	if nodeType == ZkNodetypeServer {
+		z.servicesLock.Lock()
+		if z.services == nil {
+			z.services = make(map[string]*motan.URL)
+		}
+		z.services[url.GetIdentity()] = url
+		z.servicesLock.Unlock()
+	}
 }
 
 func (z *ZkRegistry) UnRegister(url *motan.URL) {
-	z.RemoveNode(url, getNodeType(url, "unknown"))
+	nodeType := getNodeType(url, "unknown")
+	z.RemoveNode(url, nodeType)
+	if nodeType == ZkNodetypeServer {
+		z.RemoveNode(url, ZkNodetypeUnavailableServer)
+		z.servicesLock.Lock()
+		delete(z.services, url.GetIdentity())
+		z.servicesLock.Unlock()
+	}
 }
 
 // @TODO extInfo from java Obj Pase
@@ -370,16 +405,60 @@ func (z *ZkRegistry) DiscoverCommand(url *motan.URL) string {
 	return res
 }
 
+// Available move the service node from unavailableServer to server, so clients can discover it again.
+// all registered services are available if url is nil. the nodes are not changed if the service is available.
 func (z *ZkRegistry) Available(url *motan.URL) {
-
+	for _, u := range z.switchServices(url) {
+		if z.nodeExists(u, ZkNodetypeServer) && !z.nodeExists(u, ZkNodetypeUnavailableServer) {
+			continue
+		}
+		z.RemoveNode(u, ZkNodetypeUnavailableServer)
+		z.RemoveNode(u, ZkNodetypeServer)
+		if err := z.CreateNode(u, ZkNodetypeServer); err != nil {
+			vlog.Errorf("set service available fail, service:%s, error:%+v\n", u.GetIdentity(), err)
+		}
+	}
 }
 
+// Unavailable move the service node from server to unavailableServer, so clients will not call it.
+// all registered services are unavailable if url is nil. the nodes are not changed if the service is unavailable.
 func (z *ZkRegistry) Unavailable(url *motan.URL) {
+	for _, u := range z.switchServices(url) {
+		if z.nodeExists(u, ZkNodetypeUnavailableServer) && !z.nodeExists(u, ZkNodetypeServer) {
+			continue
+		}
+		z.RemoveNode(u, ZkNodetypeServer)
+		z.RemoveNode(u, ZkNodetypeUnavailableServer)
+		if err := z.CreateNode(u, ZkNodetypeUnavailableServer); err != nil {
+			vlog.Errorf("set service unavailable fail, service:%s, error:%+v\n", u.GetIdentity(), err)
+		}
+	}
+}
 
+func (z *ZkRegistry) nodeExists(url *motan.URL, nodeType string) bool {
+	exist, _, err := z.zkConn.Exists(ToNodePath(url, nodeType))
+	return err == nil && exist
+}
+
+// switchServices returns the service nodes to switch available, it is all registered services if url is nil
+func (z *ZkRegistry) switchServices(url *motan.URL) []*motan.URL {
+	if url != nil {
+		if getNodeType(url, "unknown") != ZkNodetypeServer {
+			return nil
+		}
+		return []*motan.URL{url}
+	}
+	return z.GetRegisteredServices()
 }
 
 func (z *ZkRegistry) GetRegisteredServices() []*motan.URL {
-	return nil
+	z.servicesLock.Lock()
+	defer z.servicesLock.Unlock()
+	urls := make([]*motan.URL, 0, len(z.services))
+	for _, u := range z.services {
+		urls = append(urls, u)
+	}
+	return urls
 }
 
 func (z *ZkRegistry) GetURL() *motan.URL {
@@ -0,0 +1,361 @@
+package motan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	cluster "github.com/weibocom/motan-go/cluster"
+	cfg "github.com/weibocom/motan-go/config"
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// replaced clusters are destroyed after the delay, so in-flight requests on them can finish
+const reloadDestroyDelay = 10 * time.Second
+
+// ReloadResult describes the changes applied by a config reload.
+// refers, services and registries are identified by their config ids.
+type ReloadResult struct {
+	AddedRegistries   []string `json:"addedRegistries,omitempty"`
+	RemovedRegistries []string `json:"removedRegistries,omitempty"`
+	UpdatedRegistries []string `json:"updatedRegistries,omitempty"`
+	AddedRefers       []string `json:"addedRefers,omitempty"`
+	RemovedRefers     []string `json:"removedRefers,omitempty"`
+	UpdatedRefers     []string `json:"updatedRefers,omitempty"`
+	AddedServices     []string `json:"addedServices,omitempty"`
+	RemovedServices   []string `json:"removedServices,omitempty"`
+	UpdatedServices   []string `json:"updatedServices,omitempty"`
+	Rejected          []string `json:"rejected,omitempty"` // changes not applied and the reasons
+}
+
+// configDiff is the added, removed and updated ids of a config section
+type configDiff struct {
+	added, removed, updated []string
+}
+
+// ReloadConfig re-reads the config file and applies the changes of registries, refers and services.
+// clusters of added refers are created, clusters of removed refers are destroyed, and updated refers are applied in place
+// or by new clusters, see reloadClusters.
+// updated services are exported again. a refer or service is updated if its url or any of its registries changes.
+// changes that can not be applied are rejected and the old config is kept. the motan-agent section is not reloaded.
+func (a *Agent) ReloadConfig() (result *ReloadResult, err error) {
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+	oldContext := a.Context
+	if _, err = cfg.NewConfigFromFile(oldContext.ConfigFile); err != nil {
+		return nil, err
+	}
+	newContext, err := loadContext(oldContext.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	newContext.AgentURL = oldContext.AgentURL
+	result = &ReloadResult{}
+
+	for _, url := range newContext.RefersURLs {
+		if url.Parameters[motan.ApplicationKey] == "" {
+			url.Parameters[motan.ApplicationKey] = a.agentURL.Parameters[motan.ApplicationKey]
+		}
+	}
+	result.Rejected = append(result.Rejected, rejectInvalid("refer", oldContext, newContext, newContext.RefersURLs, oldContext.RefersURLs, validateRefer)...)
+	result.Rejected = append(result.Rejected, rejectInvalid("service", oldContext, newContext, newContext.ServiceURLs, oldContext.ServiceURLs, validateService)...)
+	registryDiff := diffURLs(oldContext.RegistryURLs, newContext.RegistryURLs, nil)
+	changed := make(map[string]bool)
+	for _, id := range registryDiff.updated {
+		changed[id] = true
+	}
+	referDiff := diffURLs(oldContext.RefersURLs, newContext.RefersURLs, changed)
+	serviceDiff := diffURLs(oldContext.ServiceURLs, newContext.ServiceURLs, changed)
+
+	a.serviceLock.Lock()
+	a.Context = newContext
+	a.serviceLock.Unlock()
+	if a.dynamicClusters != nil {
+		a.dynamicClusters.createLock.Lock()
+		a.dynamicClusters.context = newContext
+		if basicRefer := newContext.BasicRefers[a.agentURL.GetParam(DynamicBasicReferKey, "")]; basicRefer != nil {
+			a.dynamicClusters.basicRefer = basicRefer
+		}
+		a.dynamicClusters.createLock.Unlock()
+	}
+	a.reloadClusters(oldContext, newContext, referDiff, changed)
+	result.Rejected = append(result.Rejected, a.reloadServices(oldContext, newContext, serviceDiff)...)
+
+	result.AddedRegistries, result.RemovedRegistries, result.UpdatedRegistries = registryDiff.added, registryDiff.removed, registryDiff.updated
+	result.AddedRefers, result.RemovedRefers, result.UpdatedRefers = referDiff.added, referDiff.removed, referDiff.updated
+	result.AddedServices, result.RemovedServices, result.UpdatedServices = serviceDiff.added, serviceDiff.removed, serviceDiff.updated
+	sort.Strings(result.Rejected)
+	vlog.Infof("agent config reloaded. result:%+v\n", result)
+	return result, nil
+}
+
+// loadContext parses the config file. the parse panic of invalid config is returned as error
+func loadContext(configFile string) (context *motan.Context, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("parse config fail: %v", e)
+		}
+	}()
+	context = &motan.Context{ConfigFile: configFile}
+	context.Initialize()
+	return context, nil
+}
+
+// reloadClusters creates clusters of added refers and destroys clusters of removed refers. an updated refer gets a new
+// cluster if its cluster key or registries change, otherwise the parameter changes are applied to the existing cluster.
+func (a *Agent) reloadClusters(oldContext, newContext *motan.Context, diff *configDiff, changedRegistries map[string]bool) {
+	var oldKeys []string
+	for _, id := range diff.removed {
+		oldKeys = append(oldKeys, getURLClusterKey(oldContext.RefersURLs[id]))
+	}
+	added := diff.added
+	updated := make(map[*cluster.MotanCluster]*motan.URL)
+	a.clusterLock.RLock()
+	for _, id := range diff.updated {
+		old, url := oldContext.RefersURLs[id], newContext.RefersURLs[id]
+		c := a.clustermap[getURLClusterKey(old)]
+		if c == nil || needRebuild(old, url, changedRegistries) {
+			oldKeys = append(oldKeys, getURLClusterKey(old))
+			added = append(added, id)
+		} else {
+			updated[c] = url
+		}
+	}
+	a.clusterLock.RUnlock()
+	for c, url := range updated {
+		c.UpdateParams(url, newContext)
+	}
+	newClusters := make(map[string]*cluster.MotanCluster)
+	for _, id := range added {
+		url := newContext.RefersURLs[id]
+		newClusters[getURLClusterKey(url)] = a.newCluster(url, newContext)
+	}
+	var destroyed []*cluster.MotanCluster
+	a.clusterLock.Lock()
+	for _, key := range oldKeys {
+		if c := a.clustermap[key]; c != nil {
+			destroyed = append(destroyed, c)
+			delete(a.clustermap, key)
+		}
+	}
+	for key, c := range newClusters {
+		if old := a.clustermap[key]; old != nil { // replace dynamic cluster
+			destroyed = append(destroyed, old)
+		}
+		if a.dynamicClusters != nil {
+			delete(a.dynamicClusters.lastAccess, key)
+		}
+		a.clustermap[key] = c
+	}
+	a.clusterLock.Unlock()
+	for _, c := range destroyed {
+		time.AfterFunc(reloadDestroyDelay, c.Destroy)
+	}
+}
+
+// needRebuild returns whether a refer change needs a new cluster, i.e. its cluster key or registries change
+func needRebuild(old, url *motan.URL, changedRegistries map[string]bool) bool {
+	return getURLClusterKey(old) != getURLClusterKey(url) ||
+		old.GetParam(motan.RegistryKey, "") != url.GetParam(motan.RegistryKey, "") ||
+		usesRegistries(url, changedRegistries)
+}
+
+// reloadServices unexports removed services, exports added services and exports updated services again.
+// a service failed to export keeps its old url in the new context, or is removed from the new context if it is added,
+// so it is exported again by next reload.
+func (a *Agent) reloadServices(oldContext, newContext *motan.Context, diff *configDiff) (rejected []string) {
+	for _, id := range diff.removed {
+		if err := a.UnexportService(oldContext.ServiceURLs[id].Path); err != nil {
+			vlog.Warningf("unexport service fail when reload config. service:%s, err:%v\n", id, err)
+		}
+	}
+	for _, id := range diff.updated {
+		if err := a.updateService(oldContext, newContext, id); err != nil {
+			vlog.Errorf("update service fail when reload config. service:%s, err:%v\n", id, err)
+			rejected = append(rejected, "service "+id+": "+err.Error())
+		}
+	}
+	for _, id := range diff.added {
+		url := newContext.ServiceURLs[id]
+		if err := a.ExportService(url.Copy()); err != nil {
+			vlog.Errorf("export service fail when reload config. service:%s, err:%v\n", id, err)
+			rejected = append(rejected, "service "+id+": "+err.Error())
+			a.serviceLock.Lock()
+			delete(newContext.ServiceURLs, id)
+			a.serviceLock.Unlock()
+		}
+	}
+	return rejected
+}
+
+// updateService replaces the exported old url of a service with the new one. if the path changes, the new url is
+// exported before the old one is unexported. otherwise the old url is exported again if the new one fails.
+func (a *Agent) updateService(oldContext, newContext *motan.Context, id string) error {
+	old, url := oldContext.ServiceURLs[id], newContext.ServiceURLs[id]
+	if old.Path != url.Path {
+		if err := a.ExportService(url.Copy()); err != nil {
+			a.restoreService(oldContext, newContext, id)
+			return err
+		}
+		if err := a.UnexportService(old.Path); err != nil {
+			vlog.Warningf("unexport service fail when reload config. service:%s, err:%v\n", id, err)
+		}
+		return nil
+	}
+	if err := a.UnexportService(old.Path); err != nil {
+		vlog.Warningf("unexport service fail when reload config. service:%s, err:%v\n", id, err)
+	}
+	err := a.ExportService(url.Copy())
+	if err != nil {
+		a.restoreService(oldContext, newContext, id)
+		if e := a.ExportService(old.Copy()); e != nil {
+			vlog.Errorf("export old service fail when reload config. service:%s, err:%v\n", id, e)
+		}
+	}
+	return err
+}
+
+// restoreService keeps the old url of a service and its registries in new context
+func (a *Agent) restoreService(oldContext, newContext *motan.Context, id string) {
+	old := oldContext.ServiceURLs[id]
+	a.serviceLock.Lock()
+	defer a.serviceLock.Unlock()
+	newContext.ServiceURLs[id] = old
+	keepRegistries(oldContext, newContext, old)
+}
+
+// rejectInvalid restores the old url of invalid urls in new context, and keeps the registries used by old urls
+func rejectInvalid(kind string, oldContext, newContext *motan.Context, newURLs, oldURLs map[string]*motan.URL, validate func(*motan.URL, *motan.Context) error) (rejected []string) {
+	for id, url := range newURLs {
+		err := validate(url, newContext)
+		if err == nil {
+			continue
+		}
+		rejected = append(rejected, kind+" "+id+": "+err.Error())
+		if old := oldURLs[id]; old != nil {
+			newURLs[id] = old
+		} else {
+			delete(newURLs, id)
+		}
+	}
+	for id, old := range oldURLs {
+		if newURLs[id] == old {
+			keepRegistries(oldContext, newContext, old)
+		}
+	}
+	return rejected
+}
+
+// keepRegistries adds the registries of url in old context to new context if they are removed
+func keepRegistries(oldContext, newContext *motan.Context, url *motan.URL) {
+	for _, r := range strings.Split(url.GetParam(motan.RegistryKey, ""), ",") {
+		if _, ok := newContext.RegistryURLs[r]; !ok && oldContext.RegistryURLs[r] != nil {
+			newContext.RegistryURLs[r] = oldContext.RegistryURLs[r]
+		}
+	}
+}
+
+func validateRefer(url *motan.URL, context *motan.Context) error {
+	if url.Path == "" {
+		return errors.New("path is empty")
+	}
+	return validateRegistries(url, context)
+}
+
+func validateService(url *motan.URL, context *motan.Context) error {
+	if url.Path == "" {
+		return errors.New("path is empty")
+	}
+	if _, _, err := motan.ParseExportInfo(url.GetParam(motan.ExportKey, "")); err != nil {
+		return err
+	}
+	return validateRegistries(url, context)
+}
+
+func validateRegistries(url *motan.URL, context *motan.Context) error {
+	regs := url.GetParam(motan.RegistryKey, "")
+	if regs == "" {
+		return errors.New("registry is empty")
+	}
+	for _, r := range strings.Split(regs, ",") {
+		if _, ok := context.RegistryURLs[r]; !ok {
+			return errors.New("registry not found: " + r)
+		}
+	}
+	return nil
+}
+
+// diffURLs compares urls by id. a url is also updated if any of its registries is in changedRegistries
+func diffURLs(oldURLs, newURLs map[string]*motan.URL, changedRegistries map[string]bool) *configDiff {
+	diff := &configDiff{}
+	for id, url := range newURLs {
+		old, ok := oldURLs[id]
+		if !ok {
+			diff.added = append(diff.added, id)
+		} else if !urlEquals(old, url) || usesRegistries(url, changedRegistries) {
+			diff.updated = append(diff.updated, id)
+		}
+	}
+	for id := range oldURLs {
+		if _, ok := newURLs[id]; !ok {
+			diff.removed = append(diff.removed, id)
+		}
+	}
+	sort.Strings(diff.added)
+	sort.Strings(diff.removed)
+	sort.Strings(diff.updated)
+	return diff
+}
+
+func urlEquals(u1, u2 *motan.URL) bool {
+	return u1.Protocol == u2.Protocol && u1.Host == u2.Host && u1.Port == u2.Port && u1.Group == u2.Group &&
+		u1.Path == u2.Path && reflect.DeepEqual(u1.Parameters, u2.Parameters)
+}
+
+func usesRegistries(url *motan.URL, registries map[string]bool) bool {
+	if len(registries) == 0 {
+		return false
+	}
+	for _, r := range strings.Split(url.GetParam(motan.RegistryKey, ""), ",") {
+		if registries[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// watchReloadSignal reloads config when SIGHUP is received
+func (a *Agent) watchReloadSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		vlog.Infoln("receive SIGHUP, reload agent config.")
+		if _, err := a.ReloadConfig(); err != nil {
+			vlog.Errorf("reload agent config fail. err:%v\n", err)
+		}
+	}
+}
+
+// reloadConfigHandler reloads config and returns the changes as json
+func (a *Agent) reloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := a.ReloadConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("reload config fail. err:" + err.Error()))
+		return
+	}
+	if data, err := json.Marshal(result); err == nil {
+		w.Write(data)
+	} else {
+		w.Write([]byte("error."))
+	}
+}
@@ -0,0 +1,222 @@
+package motan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	ha "github.com/weibocom/motan-go/ha"
+	lb "github.com/weibocom/motan-go/lb"
+)
+
+const reloadTestConfig = `
+motan-agent:
+  application: reload-test
+
+motan-registry:
+  reg1:
+    protocol: test
+    host: 127.0.0.1
+    port: 8001
+  reg2:
+    protocol: test
+    host: 127.0.0.1
+    port: 8002
+
+motan-refer:
+  keep:
+    path: com.test.Keep
+    group: test-group
+    protocol: motan2
+    registry: reg1
+  update:
+    path: com.test.Update
+    group: test-group
+    protocol: motan2
+    registry: reg1
+    requestTimeout: 100
+  move:
+    path: com.test.Move
+    group: test-group
+    protocol: motan2
+    registry: reg1
+  remove:
+    path: com.test.Remove
+    group: test-group
+    protocol: motan2
+    registry: reg1
+`
+
+const reloadTestNewConfig = `
+motan-agent:
+  application: reload-test
+
+motan-registry:
+  reg1:
+    protocol: test
+    host: 127.0.0.1
+    port: 8001
+  reg2:
+    protocol: test
+    host: 127.0.0.1
+    port: 8002
+
+motan-refer:
+  keep:
+    path: com.test.Keep
+    group: test-group
+    protocol: motan2
+    registry: reg1
+  update:
+    path: com.test.Update
+    group: test-group
+    protocol: motan2
+    registry: reg1
+    requestTimeout: 200
+  move:
+    path: com.test.Move
+    group: test-group
+    protocol: motan2
+    registry: reg2
+  add:
+    path: com.test.Add
+    group: test-group
+    protocol: motan2
+    registry: reg2
+  invalid:
+    path: com.test.Invalid
+    group: test-group
+    protocol: motan2
+    registry: reg3
+`
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "motan-reload")
+	if err != nil {
+		t.Fatalf("create temp dir fail. err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "agent.yaml")
+	if err = ioutil.WriteFile(configFile, []byte(reloadTestConfig), 0644); err != nil {
+		t.Fatalf("write config fail. err:%v", err)
+	}
+	context := &motan.Context{ConfigFile: configFile}
+	context.Initialize()
+	agent := newTestAgent(context)
+	keep := agent.clustermap[getURLClusterKey(agent.Context.RefersURLs["keep"])]
+	update := agent.clustermap[getURLClusterKey(agent.Context.RefersURLs["update"])]
+	move := agent.clustermap[getURLClusterKey(agent.Context.RefersURLs["move"])]
+
+	if err = ioutil.WriteFile(configFile, []byte(reloadTestNewConfig), 0644); err != nil {
+		t.Fatalf("write config fail. err:%v", err)
+	}
+	result, err := agent.ReloadConfig()
+	if err != nil {
+		t.Fatalf("reload config fail. err:%v", err)
+	}
+	if !reflect.DeepEqual(result.AddedRefers, []string{"add"}) || !reflect.DeepEqual(result.RemovedRefers, []string{"remove"}) ||
+		!reflect.DeepEqual(result.UpdatedRefers, []string{"move", "update"}) {
+		t.Fatalf("reload result not correct. result:%+v", result)
+	}
+	if len(result.Rejected) != 1 {
+		t.Fatalf("invalid refer should be rejected. rejected:%v", result.Rejected)
+	}
+	clusters := agent.getClusters()
+	if len(clusters) != 4 {
+		t.Fatalf("cluster size not correct. size:%d", len(clusters))
+	}
+	if clusters[getURLClusterKey(agent.Context.RefersURLs["keep"])] != keep {
+		t.Fatal("cluster of unchanged refer should be kept")
+	}
+	if c := clusters[getURLClusterKey(agent.Context.RefersURLs["update"])]; c != update {
+		t.Fatal("cluster should be updated in place if only params change")
+	} else if timeout := c.GetURL().GetParam(motan.TimeOutKey, ""); timeout != "200" {
+		t.Fatalf("cluster params should be updated. timeout:%s", timeout)
+	}
+	if c := clusters[getURLClusterKey(agent.Context.RefersURLs["move"])]; c == nil || c == move {
+		t.Fatal("cluster should be rebuilt if registry changes")
+	}
+	if clusters[getURLClusterKey(agent.Context.RefersURLs["add"])] == nil {
+		t.Fatal("cluster of added refer should be created")
+	}
+	if _, ok := agent.Context.RefersURLs["invalid"]; ok {
+		t.Fatal("invalid refer should not be in context")
+	}
+
+	os.Remove(configFile)
+	if _, err = agent.ReloadConfig(); err == nil {
+		t.Fatal("reload should fail if config file not exists")
+	}
+}
+
+func TestDiffURLs(t *testing.T) {
+	oldURLs := map[string]*motan.URL{
+		"same":     {Path: "same", Parameters: map[string]string{motan.RegistryKey: "reg1"}},
+		"param":    {Path: "param", Parameters: map[string]string{motan.TimeOutKey: "100"}},
+		"registry": {Path: "registry", Parameters: map[string]string{motan.RegistryKey: "reg2"}},
+		"removed":  {Path: "removed"},
+	}
+	newURLs := map[string]*motan.URL{
+		"same":     {Path: "same", Parameters: map[string]string{motan.RegistryKey: "reg1"}},
+		"param":    {Path: "param", Parameters: map[string]string{motan.TimeOutKey: "200"}},
+		"registry": {Path: "registry", Parameters: map[string]string{motan.RegistryKey: "reg2"}},
+		"added":    {Path: "added"},
+	}
+	diff := diffURLs(oldURLs, newURLs, map[string]bool{"reg2": true})
+	if !reflect.DeepEqual(diff.added, []string{"added"}) || !reflect.DeepEqual(diff.removed, []string{"removed"}) ||
+		!reflect.DeepEqual(diff.updated, []string{"param", "registry"}) {
+		t.Fatalf("diff not correct. diff:%+v", diff)
+	}
+}
+
+func TestRejectInvalid(t *testing.T) {
+	reg := &motan.URL{Protocol: "test"}
+	oldContext := &motan.Context{RegistryURLs: map[string]*motan.URL{"reg1": reg}}
+	newContext := &motan.Context{RegistryURLs: map[string]*motan.URL{}}
+	old := &motan.URL{Path: "invalid", Parameters: map[string]string{motan.RegistryKey: "reg1"}}
+	oldURLs := map[string]*motan.URL{"invalid": old}
+	newURLs := map[string]*motan.URL{
+		"invalid": {Path: "invalid", Parameters: map[string]string{motan.RegistryKey: "reg1"}},
+		"added":   {Parameters: map[string]string{motan.RegistryKey: "reg1"}},
+	}
+	rejected := rejectInvalid("refer", oldContext, newContext, newURLs, oldURLs, validateRefer)
+	if len(rejected) != 2 {
+		t.Fatalf("invalid urls should be rejected. rejected:%v", rejected)
+	}
+	if newURLs["invalid"] != old {
+		t.Fatal("old url should be kept for rejected url")
+	}
+	if _, ok := newURLs["added"]; ok {
+		t.Fatal("rejected new url should be removed")
+	}
+	if newContext.RegistryURLs["reg1"] != reg {
+		t.Fatal("registry of kept url should be kept")
+	}
+}
+
+// newTestAgent returns an agent with test registry and endpoint, the clusters of refers in context are created
+func newTestAgent(context *motan.Context) *Agent {
+	ext := &motan.DefaultExtentionFactory{}
+	ext.Initialize()
+	ha.RegistDefaultHa(ext)
+	lb.RegistDefaultLb(ext)
+	ext.RegistExtRegistry("test", func(url *motan.URL) motan.Registry {
+		return &motan.TestRegistry{URL: url}
+	})
+	ext.RegistExtEndpoint("test", func(url *motan.URL) motan.EndPoint {
+		return &motan.TestEndPoint{URL: url}
+	})
+	agent := NewAgent(ext)
+	agent.Context = context
+	agent.agentURL = context.AgentURL
+	if agent.agentURL == nil {
+		agent.agentURL = &motan.URL{Parameters: make(map[string]string)}
+	}
+	for _, url := range context.RefersURLs {
+		agent.clustermap[getURLClusterKey(url)] = agent.newCluster(url, context)
+	}
+	return agent
+}
@@ -21,6 +21,15 @@ func (s *SimpleSerialization) Serialize(v interface{}) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+// IsSimpleType returns whether the values of type t can be encoded by simple serialization
+func IsSimpleType(t reflect.Type) bool {
+	switch t.String() {
+	case "string", "map[string]string", "[]uint8":
+		return true
+	}
+	return false
+}
+
 func (s *SimpleSerialization) serializeBuf(v interface{}, buf *bytes.Buffer) error {
 	if v == nil {
 		buf.WriteByte(0)
@@ -113,9 +122,21 @@ func (s *SimpleSerialization) SerializeMulti(v []interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DeSerializeMulti deserialize values according to v. all values in b will be deserialized if v is nil
 func (s *SimpleSerialization) DeSerializeMulti(b []byte, v []interface{}) (ret []interface{}, err error) {
-	ret = make([]interface{}, 0, len(v))
 	buf := bytes.NewBuffer(b)
+	if v == nil {
+		ret = make([]interface{}, 0, 8)
+		for buf.Len() > 0 {
+			rv, err := s.deSerializeBuf(buf, nil)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, rv)
+		}
+		return ret, nil
+	}
+	ret = make([]interface{}, 0, len(v))
 	for _, o := range v {
 		rv, err := s.deSerializeBuf(buf, o)
 		if err != nil {
@@ -74,6 +74,12 @@ func TestSerializeMulti(t *testing.T) {
 	r := []interface{}{&rs, &rm, &rb, nil}
 	verifyMulti(a, r, simple, t)
 
+	// deserialize all values without types
+	ab, _ := simple.SerializeMulti(a)
+	result, err := simple.DeSerializeMulti(ab, nil)
+	if err != nil || len(result) != len(a) {
+		t.Errorf("deserialize multi without types fail. err:%v, result:%v\n", err, result)
+	}
 }
 
 func verifySingleValue(i interface{}, reply interface{}, simple *SimpleSerialization, t *testing.T) {
@@ -4,10 +4,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
@@ -17,16 +20,20 @@ import (
 
 // MSContext is Motan Server Context
 type MSContext struct {
-	confFile     string
-	context      *motan.Context
-	extFactory   motan.ExtentionFactory
-	portService  map[int]motan.Exporter
-	portServer   map[int]motan.Server
-	serviceImpls map[string]interface{}
-	registries   map[string]motan.Registry // all registries used for services
+	confFile         string
+	context          *motan.Context
+	extFactory       motan.ExtentionFactory
+	portService      map[int]motan.Exporter
+	portServer       map[int]motan.Server
+	serviceImpls     map[string]interface{}
+	registries       map[string]motan.Registry // all registries used for services
+	serviceExporters map[string]*mserver.DefaultExporter
+	httpHandler      http.Handler // serves http requests on the export ports
 
 	csync  sync.Mutex
 	inited bool
+
+	available int32 // 1 if services are switched available by ServicesAvailable
 }
 
 const (
@@ -85,75 +92,168 @@ func (m *MSContext) Start(extfactory motan.ExtentionFactory) {
 }
 
 func (m *MSContext) export(url *motan.URL) {
+	if err := m.doExport(url); err != nil {
+		vlog.Errorf("service export fail! url:%v, err:%v\n", url, err)
+	}
+}
+
+func (m *MSContext) doExport(url *motan.URL) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
+		if e := recover(); e != nil {
 			debug.PrintStack()
-			vlog.Errorf("MSContext export fail! url: %v, err:%+v\n", url, err)
+			vlog.Errorf("MSContext export fail! url: %v, err:%+v\n", url, e)
+			err = fmt.Errorf("export panic: %v", e)
 		}
 	}()
 	service := m.serviceImpls[url.Parameters[motan.RefKey]]
-	if service != nil {
-		//TODO multi protocol support. convert to multi url
-		export := url.GetParam(motan.ExportKey, "")
-		port := defaultServerPort
-		protocol := defaultProtocal
-		if export != "" {
-			s := strings.Split(export, ":")
-			if len(s) == 1 {
-				port = s[0]
-			} else if len(s) == 2 {
-				if s[0] != "" {
-					protocol = s[0]
-				}
-				port = s[1]
+	if service == nil {
+		return errors.New("service is not registered. ref:" + url.Parameters[motan.RefKey])
+	}
+	if _, ok := m.serviceExporters[url.Path]; ok {
+		return errors.New("service is already exported: " + url.Path)
+	}
+	//TODO multi protocol support. convert to multi url
+	export := url.GetParam(motan.ExportKey, "")
+	port := defaultServerPort
+	protocol := defaultProtocal
+	if export != "" {
+		s := strings.Split(export, ":")
+		if len(s) == 1 {
+			port = s[0]
+		} else if len(s) == 2 {
+			if s[0] != "" {
+				protocol = s[0]
 			}
+			port = s[1]
 		}
-		url.Protocol = protocol
-		porti, err := strconv.Atoi(port)
-		if err != nil {
-			vlog.Errorf("export port not int. port:%s, url:%+v\n", port, url)
-			return
-		}
-		url.Port = porti
-		if url.Host == "" {
-			url.Host = motan.GetLocalIP()
-		}
-		provider := GetDefaultExtFactory().GetProvider(url)
-		provider.SetService(service)
-		motan.Initialize(provider)
-		provider = mserver.WarperWithFilter(provider, m.extFactory)
-
-		exporter := &mserver.DefaultExporter{}
-		exporter.SetProvider(provider)
-
-		server := m.portServer[url.Port]
-
-		if server == nil {
-			server = m.extFactory.GetServer(url)
-			handler := GetDefaultExtFactory().GetMessageHandler("default")
-			motan.Initialize(handler)
-			handler.AddProvider(provider)
-			server.Open(false, false, handler, m.extFactory)
-			m.portServer[url.Port] = server
-		} else if canShareChannel(*url, *server.GetURL()) {
-			server.GetMessageHandler().AddProvider(provider)
-		} else {
-			vlog.Errorf("service export fail! can not share channel.url:%v, port url:%v\n", url, server.GetURL())
-			return
-		}
-		err = exporter.Export(server, m.extFactory, m.context)
-		if err != nil {
-			vlog.Errorf("service export fail! url:%v, err:%v\n", url, err)
-		} else {
-			vlog.Infof("service export success. url:%v\n", url)
-			for _, r := range exporter.Registrys {
-				rid := r.GetURL().GetIdentity()
-				if _, ok := m.registries[rid]; !ok {
-					m.registries[rid] = r
-				}
+	}
+	url.Protocol = protocol
+	porti, err := strconv.Atoi(port)
+	if err != nil {
+		vlog.Errorf("export port not int. port:%s, url:%+v\n", port, url)
+		return err
+	}
+	url.Port = porti
+	if url.Host == "" {
+		url.Host = motan.GetLocalIP()
+	}
+	provider := GetDefaultExtFactory().GetProvider(url)
+	provider.SetService(service)
+	motan.CanSetContext(provider, m.context)
+	motan.CanSetExtFactory(provider, m.extFactory)
+	motan.Initialize(provider)
+	provider = mserver.WarperWithFilter(provider, m.extFactory)
+
+	exporter := &mserver.DefaultExporter{Switcher: func() bool {
+		return atomic.LoadInt32(&m.available) == 1
+	}}
+	exporter.SetProvider(provider)
+
+	server := m.portServer[url.Port]
+
+	if server == nil {
+		server = m.extFactory.GetServer(url)
+		if ms, ok := server.(*mserver.MotanServer); ok && m.httpHandler != nil {
+			ms.SetHTTPHandler(m.httpHandler)
+		}
+		handler := GetDefaultExtFactory().GetMessageHandler("default")
+		motan.Initialize(handler)
+		handler.AddProvider(provider)
+		if err = server.Open(false, false, handler, m.extFactory); err != nil {
+			return err
+		}
+		m.portServer[url.Port] = server
+	} else if canShareChannel(*url, *server.GetURL()) {
+		server.GetMessageHandler().AddProvider(provider)
+	} else {
+		vlog.Errorf("service export fail! can not share channel.url:%v, port url:%v\n", url, server.GetURL())
+		return errors.New("can not share channel")
+	}
+	err = exporter.Export(server, m.extFactory, m.context)
+	if err != nil {
+		vlog.Errorf("service export fail. url:%v, err:%v\n", url, err)
+		server.GetMessageHandler().RmProvider(provider)
+		provider.Destroy()
+		m.closeIdleServer(url.Port)
+		return err
+	}
+	m.serviceExporters[url.Path] = exporter
+	vlog.Infof("service export success. url:%v\n", url)
+	for _, r := range exporter.Registrys {
+		rid := r.GetURL().GetIdentity()
+		if _, ok := m.registries[rid]; !ok {
+			m.registries[rid] = r
+		}
+	}
+	return nil
+}
+
+// ExportService export a service at runtime. the service implement is bound with the ref of url, and the implement
+// registered by RegisterService is used if service is nil.
+// it can only be called after Start, and the service is served even if it fails to register to some registries.
+func (m *MSContext) ExportService(url *motan.URL, service interface{}) error {
+	m.csync.Lock()
+	defer m.csync.Unlock()
+	if m.extFactory == nil {
+		return errors.New("server context is not started")
+	}
+	if url.Parameters == nil {
+		url.Parameters = make(map[string]string)
+	}
+	if service != nil {
+		ref := url.Parameters[motan.RefKey]
+		if ref == "" {
+			t := reflect.TypeOf(service)
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
 			}
+			ref = t.String() // same with RegisterService
+			url.Parameters[motan.RefKey] = ref
 		}
+		m.serviceImpls[ref] = service
+	}
+	return m.doExport(url)
+}
+
+// UnexportService unregister the service from its registries and remove it from server.
+// the port will be closed if no service left on it.
+func (m *MSContext) UnexportService(path string) error {
+	m.csync.Lock()
+	defer m.csync.Unlock()
+	exporter := m.serviceExporters[path]
+	if exporter == nil {
+		return errors.New("service is not exported: " + path)
+	}
+	delete(m.serviceExporters, path)
+	exporter.Unexport()
+	exporter.GetProvider().Destroy()
+	m.closeIdleServer(exporter.GetProvider().GetURL().Port)
+	removeUnusedRegistries(m.registries, exporter, m.serviceExporters)
+	vlog.Infof("service unexport success. path:%s\n", path)
+	return nil
+}
+
+// closeIdleServer closes the server of the port if no service is on it
+func (m *MSContext) closeIdleServer(port int) {
+	if server := m.portServer[port]; server != nil {
+		if lister, ok := server.GetMessageHandler().(motan.ProviderLister); ok && len(lister.GetProviders()) == 0 {
+			server.Destroy()
+			delete(m.portServer, port)
+			vlog.Infof("server port is closed because no service on it. port:%d\n", port)
+		}
+	}
+}
+
+// GetExportServices returns urls of all exported services sorted by path
+func (m *MSContext) GetExportServices() []*motan.URL {
+	m.csync.Lock()
+	defer m.csync.Unlock()
+	urls := make([]*motan.URL, 0, len(m.serviceExporters))
+	for _, exporter := range m.serviceExporters {
+		urls = append(urls, exporter.GetProvider().GetURL())
 	}
+	sort.Sort(urlsByPath(urls))
+	return urls
 }
 
 func (m *MSContext) Initialize() {
@@ -167,10 +267,17 @@ func (m *MSContext) Initialize() {
 		m.portServer = make(map[int]motan.Server, 32)
 		m.serviceImpls = make(map[string]interface{}, 32)
 		m.registries = make(map[string]motan.Registry)
+		m.serviceExporters = make(map[string]*mserver.DefaultExporter)
 		m.inited = true
 	}
 }
 
+// SetHTTPHandler set the http handler for all motan2 export ports, so health checks or debug requests can be served
+// on the same port with rpc requests. it must be called before Start
+func (m *MSContext) SetHTTPHandler(handler http.Handler) {
+	m.httpHandler = handler
+}
+
 // RegisterService register service with serviceId for config ref.
 // the type.string will used as serviceId if sid is not set. e.g. 'packageName.structName'
 func (m *MSContext) RegisterService(s interface{}, sid string) error {
@@ -206,11 +313,17 @@ func (m *MSContext) RegisterService(s interface{}, sid string) error {
 
 // ServicesAvailable will enable all service registed in registries
 func (m *MSContext) ServicesAvailable() {
+	m.csync.Lock()
+	defer m.csync.Unlock()
+	atomic.StoreInt32(&m.available, 1)
 	availableService(m.registries)
 }
 
 // ServicesUnavailable will enable all service registed in registries
 func (m *MSContext) ServicesUnavailable() {
+	m.csync.Lock()
+	defer m.csync.Unlock()
+	atomic.StoreInt32(&m.available, 0)
 	unavailableService(m.registries)
 }
 
@@ -237,6 +350,24 @@ func availableService(registries map[string]motan.Registry) {
 	}
 }
 
+// removeUnusedRegistries removes the registries of an unexported service which are not used by other services
+func removeUnusedRegistries(registries map[string]motan.Registry, unexported *mserver.DefaultExporter, exporters map[string]*mserver.DefaultExporter) {
+	for _, r := range unexported.Registrys {
+		rid := r.GetURL().GetIdentity()
+		used := false
+		for _, exporter := range exporters {
+			for _, er := range exporter.Registrys {
+				if er.GetURL().GetIdentity() == rid {
+					used = true
+				}
+			}
+		}
+		if !used {
+			delete(registries, rid)
+		}
+	}
+}
+
 func unavailableService(registries map[string]motan.Registry) {
 	defer func() {
 		if err := recover(); err != nil {
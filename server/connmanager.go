@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/metrics"
+)
+
+// url parameter keys for connection management. keys are read from server url
+const (
+	MaxConnectionsKey      = "maxConnections"
+	MaxConnectionsPerIPKey = "maxConnectionsPerIP"
+	IdleTimeoutKey         = "idleTimeout"
+)
+
+var (
+	ErrTooManyConnections      = errors.New("too many connections")
+	ErrTooManyConnectionsPerIP = errors.New("too many connections from same ip")
+)
+
+// ConnectionInfo is the runtime info of a connection accepted by server
+type ConnectionInfo struct {
+	RemoteAddr   string `json:"remoteAddr"`
+	CreateTime   int64  `json:"createTime"` // unix time in millisecond
+	Age          int64  `json:"age"`        // seconds since the connection is accepted
+	LastActive   int64  `json:"lastActive"` // unix time in millisecond of the last received message
+	RequestCount uint64 `json:"requestCount"`
+}
+
+type serverConn struct {
+	conn         net.Conn
+	writer       *connWriter
+	remoteIP     string
+	createTime   time.Time
+	lastActive   int64 // unix nano
+	requestCount uint64
+	inflights    int32 // messages received but not responded
+}
+
+func newServerConn(conn net.Conn) *serverConn {
+	now := time.Now()
+	sc := &serverConn{conn: conn, createTime: now, lastActive: now.UnixNano()}
+	if ta, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		sc.remoteIP = ta.IP.String()
+	} else {
+		sc.remoteIP = getRemoteIP(conn.RemoteAddr().String())
+	}
+	return sc
+}
+
+func (s *serverConn) active(isRequest bool) {
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+	if isRequest {
+		atomic.AddUint64(&s.requestCount, 1)
+	}
+}
+
+func (s *serverConn) begin() {
+	atomic.AddInt32(&s.inflights, 1)
+}
+
+func (s *serverConn) done() {
+	atomic.AddInt32(&s.inflights, -1)
+}
+
+func (s *serverConn) inflight() int32 {
+	return atomic.LoadInt32(&s.inflights)
+}
+
+func (s *serverConn) info() ConnectionInfo {
+	return ConnectionInfo{
+		RemoteAddr:   s.conn.RemoteAddr().String(),
+		CreateTime:   s.createTime.UnixNano() / 1e6,
+		Age:          int64(time.Since(s.createTime) / time.Second),
+		LastActive:   atomic.LoadInt64(&s.lastActive) / 1e6,
+		RequestCount: atomic.LoadUint64(&s.requestCount),
+	}
+}
+
+// connManager tracks all connections of a server and limits the connection count.
+type connManager struct {
+	maxConns      int
+	maxConnsPerIP int
+	metricsKey    string
+	lock          sync.Mutex
+	conns         map[*serverConn]struct{}
+	ipCount       map[string]int
+}
+
+func newConnManager(url *motan.URL) *connManager {
+	application := url.GetParam(motan.ApplicationKey, "")
+	return &connManager{
+		maxConns:      int(url.GetIntValue(MaxConnectionsKey, 0)),
+		maxConnsPerIP: int(url.GetIntValue(MaxConnectionsPerIPKey, 0)),
+		metricsKey:    strings.Replace(fmt.Sprintf("motan-server:%s:connection:%d", application, url.Port), ".", "_", -1),
+		conns:         make(map[*serverConn]struct{}),
+		ipCount:       make(map[string]int),
+	}
+}
+
+func (c *connManager) add(sc *serverConn) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.maxConns > 0 && len(c.conns) >= c.maxConns {
+		c.addMetrics("reject_count", 1)
+		return ErrTooManyConnections
+	}
+	if c.maxConnsPerIP > 0 && c.ipCount[sc.remoteIP] >= c.maxConnsPerIP {
+		c.addMetrics("reject_count", 1)
+		return ErrTooManyConnectionsPerIP
+	}
+	c.conns[sc] = struct{}{}
+	c.ipCount[sc.remoteIP]++
+	c.addMetrics("accept_count", 1)
+	metrics.AddGauge(c.metricsKey+":current_count", int64(len(c.conns)))
+	return nil
+}
+
+func (c *connManager) remove(sc *serverConn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.conns[sc]; !ok {
+		return
+	}
+	delete(c.conns, sc)
+	if c.ipCount[sc.remoteIP] <= 1 {
+		delete(c.ipCount, sc.remoteIP)
+	} else {
+		c.ipCount[sc.remoteIP]--
+	}
+	metrics.AddGauge(c.metricsKey+":current_count", int64(len(c.conns)))
+}
+
+func (c *connManager) addMetrics(name string, value int64) {
+	metrics.AddCounter(c.metricsKey+":"+name, value)
+}
+
+func (c *connManager) list() []ConnectionInfo {
+	c.lock.Lock()
+	infos := make([]ConnectionInfo, 0, len(c.conns))
+	for sc := range c.conns {
+		infos = append(infos, sc.info())
+	}
+	c.lock.Unlock()
+	sort.Sort(connectionInfos(infos))
+	return infos
+}
+
+// connectionInfos sorts connections by create time
+type connectionInfos []ConnectionInfo
+
+func (c connectionInfos) Len() int {
+	return len(c)
+}
+func (c connectionInfos) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+func (c connectionInfos) Less(i, j int) bool {
+	return c[i].CreateTime < c[j].CreateTime
+}
+
+func (c *connManager) closeAll() {
+	c.lock.Lock()
+	conns := make([]*serverConn, 0, len(c.conns))
+	for sc := range c.conns {
+		conns = append(conns, sc)
+	}
+	c.lock.Unlock()
+	for _, sc := range conns {
+		if sc.writer != nil {
+			sc.writer.Close()
+		} else {
+			sc.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+func TestConnManager(t *testing.T) {
+	url := &motan.URL{Port: 8100, Parameters: map[string]string{MaxConnectionsKey: "3", MaxConnectionsPerIPKey: "2"}}
+	cm := newConnManager(url)
+	conns := make([]*serverConn, 0, 3)
+	for i := 0; i < 3; i++ {
+		c, _ := net.Pipe()
+		sc := newServerConn(c)
+		conns = append(conns, sc)
+	}
+	if err := cm.add(conns[0]); err != nil {
+		t.Fatalf("add connection fail. err:%v", err)
+	}
+	if err := cm.add(conns[1]); err != nil {
+		t.Fatalf("add connection fail. err:%v", err)
+	}
+	if err := cm.add(conns[2]); err != ErrTooManyConnectionsPerIP {
+		t.Fatalf("connection should be rejected by ip limit. err:%v", err)
+	}
+	conns[0].active(true)
+	conns[0].active(false)
+	infos := cm.list()
+	if len(infos) != 2 {
+		t.Fatalf("connection size not correct. size:%d", len(infos))
+	}
+	var requests uint64
+	for _, info := range infos {
+		requests += info.RequestCount
+	}
+	if requests != 1 {
+		t.Fatalf("request count not correct. count:%d", requests)
+	}
+	cm.remove(conns[1])
+	if err := cm.add(conns[2]); err != nil {
+		t.Fatalf("add connection fail after remove. err:%v", err)
+	}
+	cm.maxConnsPerIP = 0
+	cm.maxConns = 2
+	if err := cm.add(conns[1]); err != ErrTooManyConnections {
+		t.Fatalf("connection should be rejected by max connections. err:%v", err)
+	}
+	cm.closeAll()
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// url parameter keys for connection writer. keys are read from server url
+const (
+	WriteQueueSizeKey = "writeQueueSize"
+	WriteTimeoutKey   = "writeTimeout"
+	WriteBatchSizeKey = "writeBatchSize"
+)
+
+const (
+	defaultWriteQueueSize = 256
+	defaultWriteTimeout   = 3000 * time.Millisecond
+	defaultWriteBatchSize = 64 * 1024
+)
+
+var (
+	ErrConnClosed        = errors.New("connection is closed")
+	ErrWriteQueueTimeout = errors.New("connection write queue is full")
+)
+
+type connWriterConfig struct {
+	queueSize    int
+	writeTimeout time.Duration
+	batchSize    int
+}
+
+func newConnWriterConfig(url *motan.URL) *connWriterConfig {
+	return &connWriterConfig{
+		queueSize:    int(url.GetPositiveIntValue(WriteQueueSizeKey, defaultWriteQueueSize)),
+		writeTimeout: url.GetTimeDuration(WriteTimeoutKey, time.Millisecond, defaultWriteTimeout),
+		batchSize:    int(url.GetPositiveIntValue(WriteBatchSizeKey, defaultWriteBatchSize)),
+	}
+}
+
+// connWriter serializes all writes of one connection in a single goroutine.
+// small responses in queue will be written in one batch, and the connection will be closed if write fail.
+type connWriter struct {
+	conn      net.Conn
+	config    *connWriterConfig
+	queue     chan []byte
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	batch     bytes.Buffer // only used by the writer goroutine
+}
+
+func newConnWriter(conn net.Conn, config *connWriterConfig) *connWriter {
+	w := &connWriter{
+		conn:    conn,
+		config:  config,
+		queue:   make(chan []byte, config.queueSize),
+		closeCh: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write put data into write queue. it will wait at most writeTimeout if queue is full,
+// and the connection will be closed because the peer is not reading.
+func (w *connWriter) Write(data []byte) error {
+	select {
+	case <-w.closeCh:
+		return ErrConnClosed
+	default:
+	}
+	select {
+	case w.queue <- data:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(w.config.writeTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- data:
+		return nil
+	case <-w.closeCh:
+		return ErrConnClosed
+	case <-timer.C:
+		vlog.Warningf("motan server write queue timeout, connection will close. conn:%s\n", w.conn.RemoteAddr().String())
+		w.Close()
+		return ErrWriteQueueTimeout
+	}
+}
+
+func (w *connWriter) run() {
+	for {
+		select {
+		case data := <-w.queue:
+			if err := w.writeBatch(data); err != nil {
+				vlog.Warningf("motan server write fail, connection will close. conn:%s, err:%s\n", w.conn.RemoteAddr().String(), err.Error())
+				w.Close()
+				return
+			}
+		case <-w.closeCh:
+			return
+		}
+	}
+}
+
+// writeBatch write the data and the following queued data together until batchSize reached.
+func (w *connWriter) writeBatch(data []byte) error {
+	for len(data) < w.config.batchSize {
+		select {
+		case next := <-w.queue:
+			if w.batch.Len() == 0 {
+				w.batch.Write(data)
+			}
+			w.batch.Write(next)
+			data = w.batch.Bytes()
+			continue
+		default:
+		}
+		break
+	}
+	if w.config.writeTimeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.config.writeTimeout))
+	}
+	_, err := w.conn.Write(data)
+	w.batch.Reset()
+	return err
+}
+
+// Close close the writer and the connection. it is safe to call Close many times.
+func (w *connWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closeCh)
+		w.conn.Close()
+	})
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnWriter(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	writer := newConnWriter(server, &connWriterConfig{queueSize: 16, writeTimeout: 100 * time.Millisecond, batchSize: 1024})
+	expect := make([]byte, 0, 64)
+	for i := 0; i < 8; i++ {
+		data := []byte{byte(i), byte(i), byte(i)}
+		expect = append(expect, data...)
+		if err := writer.Write(data); err != nil {
+			t.Fatalf("write fail. err:%v", err)
+		}
+	}
+	received := make([]byte, len(expect))
+	if _, err := io.ReadFull(client, received); err != nil {
+		t.Fatalf("read fail. err:%v", err)
+	}
+	if !bytes.Equal(expect, received) {
+		t.Fatalf("write order not correct. expect:%v, real:%v", expect, received)
+	}
+
+	// peer does not read, write deadline will close the connection
+	writer.Write([]byte{1})
+	time.Sleep(200 * time.Millisecond)
+	if err := writer.Write([]byte{1}); err != ErrConnClosed {
+		t.Fatalf("writer should be closed after write timeout. err:%v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// url parameter keys for server concurrency control.
+// pool keys are read from server url, service keys are read from provider(service) url.
+const (
+	WorkerPoolSizeKey  = "workerPoolSize"
+	WorkerQueueSizeKey = "workerQueueSize"
+	MaxConcurrentKey   = "maxConcurrent"
+	MaxQueueSizeKey    = "maxQueueSize"
+	QueueTimeoutKey    = "queueTimeout"
+)
+
+const (
+	defaultWorkerQueueSize = 1024
+	defaultQueueTimeout    = 100 * time.Millisecond
+	serverBusyErrMsg       = "server busy"
+)
+
+var (
+	ErrServerBusy     = errors.New("server busy: worker queue is full")
+	ErrWorkerPoolStop = errors.New("worker pool is stopped")
+)
+
+// workerPool is a fixed size goroutine pool with a bounded task queue.
+type workerPool struct {
+	size     int
+	tasks    chan func()
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newWorkerPool(size int, queueSize int) *workerPool {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &workerPool{size: size, tasks: make(chan func(), queueSize), stopCh: make(chan struct{})}
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for {
+		select {
+		case task := <-p.tasks:
+			runTask(task)
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+func runTask(task func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			vlog.Errorln("worker pool task error! ", err)
+		}
+	}()
+	task()
+}
+
+// Submit never blocks. ErrServerBusy is returned if all workers are busy and the queue is full.
+func (p *workerPool) Submit(task func()) error {
+	select {
+	case <-p.stopCh:
+		return ErrWorkerPoolStop
+	default:
+	}
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		return ErrServerBusy
+	}
+}
+
+func (p *workerPool) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+}
+
+// serviceLimiter limits the concurrent requests of one service(provider path).
+// requests over maxConcurrent will wait in queue at most queueTimeout, and will be rejected if queue is full.
+type serviceLimiter struct {
+	sem          chan struct{}
+	maxQueueSize int32
+	queueTimeout time.Duration
+	waiting      int32
+	rejected     uint64
+}
+
+func newServiceLimiter(url *motan.URL) *serviceLimiter {
+	maxConcurrent := url.GetIntValue(MaxConcurrentKey, 0)
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &serviceLimiter{
+		sem:          make(chan struct{}, maxConcurrent),
+		maxQueueSize: int32(url.GetIntValue(MaxQueueSizeKey, 0)),
+		queueTimeout: url.GetTimeDuration(QueueTimeoutKey, time.Millisecond, defaultQueueTimeout),
+	}
+}
+
+// TryAcquire never blocks, it returns false if the service is at max concurrency
+func (s *serviceLimiter) TryAcquire() bool {
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *serviceLimiter) Acquire() bool {
+	if s.TryAcquire() {
+		return true
+	}
+	if atomic.AddInt32(&s.waiting, 1) > s.maxQueueSize {
+		atomic.AddInt32(&s.waiting, -1)
+		atomic.AddUint64(&s.rejected, 1)
+		return false
+	}
+	defer atomic.AddInt32(&s.waiting, -1)
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		atomic.AddUint64(&s.rejected, 1)
+		return false
+	}
+}
+
+func (s *serviceLimiter) Release() {
+	<-s.sem
+}
+
+func (s *serviceLimiter) Active() int {
+	return len(s.sem)
+}
+
+func (s *serviceLimiter) Waiting() int {
+	return int(atomic.LoadInt32(&s.waiting))
+}
+
+func (s *serviceLimiter) Rejected() uint64 {
+	return atomic.LoadUint64(&s.rejected)
+}
+
+func buildServerBusyException() *motan.Exception {
+	return &motan.Exception{ErrCode: motan.ServerBusyErrCode, ErrMsg: serverBusyErrMsg, ErrType: motan.ServiceException}
+}
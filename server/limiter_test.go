@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := newWorkerPool(1, 1)
+	defer pool.Stop()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if err := pool.Submit(func() {
+		close(started)
+		<-block
+	}); err != nil {
+		t.Fatalf("submit to idle pool fail. err:%v", err)
+	}
+	<-started
+	if err := pool.Submit(func() {}); err != nil {
+		t.Fatalf("submit to queue fail. err:%v", err)
+	}
+	if err := pool.Submit(func() {}); err != ErrServerBusy {
+		t.Fatalf("submit to full pool should be rejected. err:%v", err)
+	}
+	close(block)
+}
+
+func TestServiceLimiter(t *testing.T) {
+	url := &motan.URL{Parameters: map[string]string{MaxConcurrentKey: "1", MaxQueueSizeKey: "1", QueueTimeoutKey: "50"}}
+	limiter := newServiceLimiter(url)
+	if limiter == nil {
+		t.Fatal("limiter should not be nil")
+	}
+	if !limiter.Acquire() {
+		t.Fatal("first acquire should success")
+	}
+	waitResult := make(chan bool)
+	go func() {
+		waitResult <- limiter.Acquire()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if limiter.Waiting() != 1 {
+		t.Fatalf("waiting count not correct. waiting:%d", limiter.Waiting())
+	}
+	if limiter.TryAcquire() {
+		t.Fatal("try acquire should fail at max concurrency")
+	}
+	// queue is full
+	if limiter.Acquire() {
+		t.Fatal("acquire should be rejected when queue is full")
+	}
+	limiter.Release()
+	if !<-waitResult {
+		t.Fatal("queued acquire should success after release")
+	}
+	// queue timeout
+	if limiter.Acquire() {
+		t.Fatal("acquire should timeout")
+	}
+	if limiter.Rejected() != 2 {
+		t.Fatalf("rejected count not correct. rejected:%d", limiter.Rejected())
+	}
+	if newServiceLimiter(&motan.URL{}) != nil {
+		t.Fatal("limiter should be nil without maxConcurrent")
+	}
+}
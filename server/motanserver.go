@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"errors"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
@@ -18,6 +22,22 @@ type MotanServer struct {
 	listener   net.Listener
 	extFactory motan.ExtentionFactory
 	proxy      bool
+
+	writerConfig *connWriterConfig
+	conns        *connManager
+	idleTimeout  time.Duration
+	pool         *workerPool
+	limiters     map[string]*limiterHolder
+	limiterLock  sync.RWMutex
+	httpHandler  http.Handler
+	http         *httpServer
+	closed       int32
+}
+
+// limiterHolder binds a service limiter with the provider it built from, so the limiter will be rebuilt if provider changed.
+type limiterHolder struct {
+	provider motan.Provider
+	limiter  *serviceLimiter
 }
 
 func (m *MotanServer) Open(block bool, proxy bool, handler motan.MessageHandler, extFactory motan.ExtentionFactory) error {
@@ -30,6 +50,18 @@ func (m *MotanServer) Open(block bool, proxy bool, handler motan.MessageHandler,
 	m.handler = handler
 	m.extFactory = extFactory
 	m.proxy = proxy
+	m.limiters = make(map[string]*limiterHolder)
+	m.writerConfig = newConnWriterConfig(m.URL)
+	m.conns = newConnManager(m.URL)
+	m.idleTimeout = m.URL.GetTimeDuration(IdleTimeoutKey, time.Millisecond, 0)
+	if poolSize := m.URL.GetIntValue(WorkerPoolSizeKey, 0); poolSize > 0 {
+		m.pool = newWorkerPool(int(poolSize), int(m.URL.GetIntValue(WorkerQueueSizeKey, defaultWorkerQueueSize)))
+		vlog.Infof("motan server worker pool is enabled. port:%d, size:%d\n", m.URL.Port, poolSize)
+	}
+	if m.httpHandler != nil {
+		m.http = newHTTPServer(lis.Addr(), m.httpHandler, m.conns, m.idleTimeout)
+		vlog.Infof("motan server http is enabled. port:%d\n", m.URL.Port)
+	}
 	vlog.Infof("motan server is started. port:%d\n", m.URL.Port)
 	if block {
 		m.run()
@@ -47,6 +79,13 @@ func (m *MotanServer) SetMessageHandler(mh motan.MessageHandler) {
 	m.handler = mh
 }
 
+// SetHTTPHandler set the handler for http requests on the motan port. the protocol of each connection is sniffed
+// by the first bytes, connections start with a http method will be served by this handler.
+// it must be called before Open, and http requests will be rejected if the handler is not set.
+func (m *MotanServer) SetHTTPHandler(handler http.Handler) {
+	m.httpHandler = handler
+}
+
 func (m *MotanServer) GetURL() *motan.URL {
 	return m.URL
 }
@@ -60,52 +99,219 @@ func (m *MotanServer) GetName() string {
 }
 
 func (m *MotanServer) Destroy() {
+	atomic.StoreInt32(&m.closed, 1)
+	if m.pool != nil {
+		m.pool.Stop()
+	}
+	if m.http != nil {
+		m.http.close()
+	}
 	err := m.listener.Close()
 	if err != nil {
 		vlog.Errorf("motan server destroy fail.url %v, err :%s\n", m.URL, err.Error())
 	} else {
 		vlog.Infof("motan server destroy sucess.url %v\n", m.URL)
 	}
+	m.conns.closeAll()
+}
+
+// GetConnections returns all current connections of this server
+func (m *MotanServer) GetConnections() []ConnectionInfo {
+	if m.conns == nil {
+		return nil
+	}
+	return m.conns.list()
 }
 
 func (m *MotanServer) run() {
 	for {
 		conn, err := m.listener.Accept()
 		if err != nil {
+			if atomic.LoadInt32(&m.closed) == 1 {
+				vlog.Infof("motan server stop accept. port:%d\n", m.URL.Port)
+				return
+			}
 			vlog.Errorf("motan server accept from port %v fail. err:%s\n", m.listener.Addr(), err.Error())
+			time.Sleep(10 * time.Millisecond) // avoid busy loop when accept fail continuously
 		} else {
-
-			go m.handleConn(conn)
+			sc := newServerConn(conn)
+			if err := m.conns.add(sc); err != nil {
+				vlog.Warningf("motan server reject connection. port:%d, conn:%s, err:%s\n", m.URL.Port, conn.RemoteAddr().String(), err.Error())
+				conn.Close()
+				continue
+			}
+			go m.handleConn(sc)
 		}
 	}
 }
 
-func (m *MotanServer) handleConn(conn net.Conn) {
+func (m *MotanServer) handleConn(sc *serverConn) {
+	conn := sc.conn
+	handOver := false
 	defer func() {
 		if err := recover(); err != nil {
 			vlog.Errorln("connection encount error! ", err)
 		}
-		conn.Close()
+		if handOver {
+			return
+		}
+		if sc.writer != nil {
+			sc.writer.Close()
+		} else {
+			conn.Close()
+		}
+		m.conns.remove(sc)
 	}()
 	buf := bufio.NewReader(conn)
+	if m.http != nil {
+		if m.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(m.idleTimeout))
+		}
+		if head, err := buf.Peek(2); err != nil {
+			return
+		} else if !isMotanMagic(head) && sniffHTTP(buf) {
+			conn.SetReadDeadline(time.Time{})
+			if err := m.http.serve(sc, buf); err != nil {
+				vlog.Warningf("motan server serve http fail. conn:%s, err:%s\n", conn.RemoteAddr().String(), err.Error())
+				return
+			}
+			handOver = true
+			return
+		}
+	}
+	sc.writer = newConnWriter(conn, m.writerConfig)
 	for {
-		request, err := mpro.Decode(buf)
+		var request *mpro.Message
+		var err error
+		if m.idleTimeout > 0 { // heartbeat is also a message, so connection with heartbeat will not be idle
+			err = m.waitRequest(sc, buf)
+		}
+		if err == nil {
+			request, err = mpro.Decode(buf)
+		}
 		if err != nil {
-			if err.Error() != "EOF" {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				vlog.Infof("motan server close idle connection. con:%s, idle:%v\n", conn.RemoteAddr().String(), m.idleTimeout)
+				m.conns.addMetrics("idle_close_count", 1)
+			} else if err.Error() != "EOF" {
 				vlog.Warningf("decode motan message fail! con:%s\n.", conn.RemoteAddr().String())
 			}
 			break
 		}
-		go m.processReq(request, conn)
+		sc.active(!request.Header.IsHeartbeat())
+		sc.begin()
+		m.dispatch(request, sc)
 	}
 }
 
-func (m *MotanServer) processReq(request *mpro.Message, conn net.Conn) {
+// waitRequest waits until the next message arrives. a connection is idle if nothing is received in idle timeout
+// and no request is in flight, the deadline is extended while requests are in flight because their responses
+// are not sent yet. it peeks instead of decoding, so a timeout never breaks a partly read message.
+func (m *MotanServer) waitRequest(sc *serverConn, buf *bufio.Reader) error {
+	for {
+		sc.conn.SetReadDeadline(time.Now().Add(m.idleTimeout))
+		_, err := buf.Peek(1)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() && sc.inflight() > 0 {
+			continue
+		}
+		return err
+	}
+}
+
+// dispatch process request in worker pool if pool is enabled, and check the concurrency limit of the service.
+// request over limit will be rejected with a server busy exception. the limit is acquired before submitting to the pool,
+// and requests waiting in the queue of a saturated service do not take workers from other services.
+func (m *MotanServer) dispatch(request *mpro.Message, sc *serverConn) {
+	if request.Header.IsHeartbeat() {
+		go m.processReq(request, sc)
+		return
+	}
+	limiter := m.getLimiter(request.Metadata[mpro.MPath])
+	if limiter == nil {
+		m.submit(request, sc, func() {
+			m.processReq(request, sc)
+		})
+		return
+	}
+	task := func() {
+		defer limiter.Release()
+		m.processReq(request, sc)
+	}
+	if limiter.TryAcquire() {
+		if !m.submit(request, sc, task) {
+			limiter.Release()
+		}
+		return
+	}
+	go func() { // wait in queue without blocking the connection reading
+		if !limiter.Acquire() {
+			vlog.Warningf("motan server reject request, service concurrency over limit. rid:%d, service:%s, method:%s\n", request.Header.RequestID, request.Metadata[mpro.MPath], request.Metadata[mpro.MMethod])
+			m.rejectReq(request, sc)
+			return
+		}
+		if !m.submit(request, sc, task) {
+			limiter.Release()
+		}
+	}()
+}
+
+// submit runs the task in worker pool or a new goroutine. the request is rejected if the pool is busy
+func (m *MotanServer) submit(request *mpro.Message, sc *serverConn, task func()) bool {
+	if m.pool == nil {
+		go task()
+		return true
+	}
+	if err := m.pool.Submit(task); err != nil {
+		vlog.Warningf("motan server reject request. rid:%d, service:%s, method:%s, err:%s\n", request.Header.RequestID, request.Metadata[mpro.MPath], request.Metadata[mpro.MMethod], err.Error())
+		m.rejectReq(request, sc)
+		return false
+	}
+	return true
+}
+
+func (m *MotanServer) getLimiter(path string) *serviceLimiter {
+	if m.handler == nil {
+		return nil
+	}
+	provider := m.handler.GetProvider(path)
+	if provider == nil {
+		return nil
+	}
+	m.limiterLock.RLock()
+	holder := m.limiters[path]
+	m.limiterLock.RUnlock()
+	if holder != nil && holder.provider == provider {
+		return holder.limiter
+	}
+	m.limiterLock.Lock()
+	defer m.limiterLock.Unlock()
+	if holder = m.limiters[path]; holder == nil || holder.provider != provider {
+		holder = &limiterHolder{provider: provider, limiter: newServiceLimiter(provider.GetURL())}
+		m.limiters[path] = holder
+	}
+	return holder.limiter
+}
+
+func (m *MotanServer) rejectReq(request *mpro.Message, sc *serverConn) {
+	defer sc.done()
+	res := mpro.BuildExceptionResponse(request.Header.RequestID, mpro.ExceptionToJSON(buildServerBusyException()))
+	writeRes(res, sc.writer)
+}
+
+func writeRes(res *mpro.Message, writer *connWriter) {
+	if err := writer.Write(res.Encode().Bytes()); err != nil {
+		vlog.Warningf("motan server write response fail. rid:%d, conn:%s, err:%s\n", res.Header.RequestID, writer.conn.RemoteAddr().String(), err.Error())
+	}
+}
+
+func (m *MotanServer) processReq(request *mpro.Message, sc *serverConn) {
+	defer sc.done()
 	defer func() {
 		if err := recover(); err != nil {
 			vlog.Errorln("Motanserver processReq error! ", err)
 		}
 	}()
+	writer := sc.writer
 	request.Header.SetProxy(m.proxy)
 	// TODO request , response reuse
 	var res *mpro.Message
@@ -116,10 +322,10 @@ func (m *MotanServer) processReq(request *mpro.Message, conn net.Conn) {
 		serialization := m.extFactory.GetSerialization("", request.Header.GetSerialize())
 		req, err := mpro.ConvertToRequest(request, serialization)
 
-		if ta, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		if ta, ok := writer.conn.RemoteAddr().(*net.TCPAddr); ok {
 			req.SetAttachment(motan.HostKey, ta.IP.String())
 		} else {
-			req.SetAttachment(motan.HostKey, getRemoteIP(conn.RemoteAddr().String()))
+			req.SetAttachment(motan.HostKey, getRemoteIP(writer.conn.RemoteAddr().String()))
 		}
 
 		req.GetRPCContext(true).ExtFactory = m.extFactory
@@ -128,7 +334,11 @@ func (m *MotanServer) processReq(request *mpro.Message, conn net.Conn) {
 			mres = motan.BuildExceptionResponse(request.Header.RequestID, &motan.Exception{ErrCode: 500, ErrMsg: "deserialize fail. method:" + request.Metadata[mpro.MMethod], ErrType: motan.ServiceException})
 		} else {
 			req.GetRPCContext(true).ExtFactory = m.extFactory
-			mres = m.handler.Call(req)
+			if _, ok := m.handler.(motan.ProviderLister); ok && req.GetServiceName() == ReflectionService {
+				mres = callReflection(m.handler, req)
+			} else {
+				mres = m.handler.Call(req)
+			}
 			//TOOD oneway
 		}
 		if mres != nil {
@@ -142,8 +352,7 @@ func (m *MotanServer) processReq(request *mpro.Message, conn net.Conn) {
 			res = mpro.BuildExceptionResponse(request.Header.RequestID, mpro.ExceptionToJSON(&motan.Exception{ErrCode: 500, ErrMsg: "convert to response fail.", ErrType: motan.ServiceException}))
 		}
 	}
-	resbuf := res.Encode()
-	conn.Write(resbuf.Bytes())
+	writeRes(res, writer)
 }
 
 func getRemoteIP(address string) string {
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+func TestMotanServerDestroy(t *testing.T) {
+	server := &MotanServer{URL: &motan.URL{Port: 0}}
+	handler := &DefaultMessageHandler{}
+	handler.Initialize()
+	if err := server.Open(false, false, handler, nil); err != nil {
+		t.Fatalf("open server fail. err:%v", err)
+	}
+	addr := server.listener.Addr().String()
+	server.Destroy()
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Fatal("server should stop accepting after destroy")
+	}
+}
+
+func TestWaitRequest(t *testing.T) {
+	server := &MotanServer{idleTimeout: 20 * time.Millisecond}
+	c, peer := net.Pipe()
+	defer c.Close()
+	defer peer.Close()
+	sc := newServerConn(c)
+	buf := bufio.NewReader(c)
+	if err := server.waitRequest(sc, buf); err == nil {
+		t.Fatal("connection without in-flight requests should be idle")
+	}
+	sc.begin()
+	go func() {
+		time.Sleep(60 * time.Millisecond)
+		peer.Write([]byte{0xF1})
+	}()
+	if err := server.waitRequest(sc, buf); err != nil {
+		t.Fatalf("connection with in-flight requests should not be idle. err:%v", err)
+	}
+	sc.done()
+}
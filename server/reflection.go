@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+// ReflectionService is the path of built-in reflection service. it is served by MotanServer when the message handler
+// can list its providers, so callers can discover the services and methods of a server at runtime.
+// method listServices() returns json array of ServiceInfo, and getService(path) returns json of the ServiceInfo.
+const ReflectionService = "motan.ReflectionService"
+
+// ServiceInfo is the description of a service exported by server
+type ServiceInfo struct {
+	Path     string             `json:"path"`
+	Group    string             `json:"group"`
+	Version  string             `json:"version"`
+	Protocol string             `json:"protocol"`
+	Methods  []motan.MethodInfo `json:"methods,omitempty"` // methods are only available for providers which can describe methods
+}
+
+// GetServices returns the services of message handler sorted by path. nil is returned if handler can not list providers
+func GetServices(handler motan.MessageHandler) []ServiceInfo {
+	lister, ok := handler.(motan.ProviderLister)
+	if !ok {
+		return nil
+	}
+	providers := lister.GetProviders()
+	services := make([]ServiceInfo, 0, len(providers))
+	for _, p := range providers {
+		services = append(services, buildServiceInfo(p))
+	}
+	sort.Sort(serviceInfos(services))
+	return services
+}
+
+// serviceInfos sorts services by path
+type serviceInfos []ServiceInfo
+
+func (s serviceInfos) Len() int {
+	return len(s)
+}
+func (s serviceInfos) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s serviceInfos) Less(i, j int) bool {
+	return s[i].Path < s[j].Path
+}
+
+func buildServiceInfo(p motan.Provider) ServiceInfo {
+	info := ServiceInfo{Path: p.GetPath()}
+	if url := p.GetURL(); url != nil {
+		info.Group = url.Group
+		info.Version = url.GetParam(motan.VersionKey, "")
+		info.Protocol = url.Protocol
+	}
+	if md, ok := p.(motan.MethodDescriber); ok {
+		info.Methods = md.GetMethods()
+	}
+	return info
+}
+
+// callReflection process the request of reflection service
+func callReflection(handler motan.MessageHandler, request motan.Request) motan.Response {
+	var result interface{}
+	switch request.GetMethod() {
+	case "listServices":
+		result = GetServices(handler)
+	case "getService":
+		var path string
+		if err := request.ProcessDeserializable([]interface{}{&path}); err != nil || len(request.GetArguments()) != 1 {
+			return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "getService need a service path argument", ErrType: motan.ServiceException})
+		}
+		path, _ = request.GetArguments()[0].(string)
+		p := handler.GetProvider(path)
+		if p == nil {
+			return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 404, ErrMsg: "service not found: " + path, ErrType: motan.BizException})
+		}
+		result = buildServiceInfo(p)
+	default:
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "method " + request.GetMethod() + " is not found in " + ReflectionService, ErrType: motan.ServiceException})
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		vlog.Errorf("reflection service marshal result fail. err:%s\n", err.Error())
+		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "marshal result fail", ErrType: motan.ServiceException})
+	}
+	return &motan.MotanResponse{RequestID: request.GetRequestID(), Value: string(b)}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+type describedProvider struct {
+	url *motan.URL
+}
+
+func (d *describedProvider) SetService(s interface{})          {}
+func (d *describedProvider) GetURL() *motan.URL                { return d.url }
+func (d *describedProvider) SetURL(url *motan.URL)             { d.url = url }
+func (d *describedProvider) IsAvailable() bool                 { return true }
+func (d *describedProvider) Call(motan.Request) motan.Response { return &motan.MotanResponse{} }
+func (d *describedProvider) Destroy()                          {}
+func (d *describedProvider) GetPath() string                   { return d.url.Path }
+func (d *describedProvider) GetMethods() []motan.MethodInfo {
+	return []motan.MethodInfo{{Name: "Hello", Args: []string{"string"}, Reply: "string"}}
+}
+
+func TestReflectionService(t *testing.T) {
+	handler := &DefaultMessageHandler{}
+	handler.Initialize()
+	url := &motan.URL{Protocol: "motan2", Group: "test-group", Path: "test.service", Parameters: map[string]string{motan.VersionKey: "1.0"}}
+	handler.AddProvider(&FilterProviderWarper{provider: &describedProvider{url: url}})
+
+	res := callReflection(handler, &motan.MotanRequest{ServiceName: ReflectionService, Method: "listServices"})
+	if res.GetException() != nil {
+		t.Fatalf("list services fail. exception:%+v", res.GetException())
+	}
+	var services []ServiceInfo
+	if err := json.Unmarshal([]byte(res.GetValue().(string)), &services); err != nil {
+		t.Fatalf("unmarshal services fail. err:%v", err)
+	}
+	if len(services) != 1 || services[0].Path != "test.service" || services[0].Group != "test-group" || services[0].Version != "1.0" {
+		t.Fatalf("services not correct. services:%+v", services)
+	}
+	if len(services[0].Methods) != 1 || services[0].Methods[0].Name != "Hello" {
+		t.Fatalf("methods not correct. methods:%+v", services[0].Methods)
+	}
+
+	res = callReflection(handler, &motan.MotanRequest{ServiceName: ReflectionService, Method: "getService", Arguments: []interface{}{"test.service"}})
+	if res.GetException() != nil {
+		t.Fatalf("get service fail. exception:%+v", res.GetException())
+	}
+	res = callReflection(handler, &motan.MotanRequest{ServiceName: ReflectionService, Method: "getService", Arguments: []interface{}{"unknown"}})
+	if res.GetException() == nil || res.GetException().ErrCode != 404 {
+		t.Fatalf("get unknown service should fail. res:%+v", res)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	motan "github.com/weibocom/motan-go/core"
 	"github.com/weibocom/motan-go/log"
@@ -33,12 +35,20 @@ func RegistDefaultMessageHandlers(extFactory motan.ExtentionFactory) {
 	})
 }
 
+// AvailableCheckIntervalKey : interval in millisecond to check whether the provider is available.
+// the service will be set unavailable in registries when provider is unavailable, e.g. the backend of cgi provider is dead
+const AvailableCheckIntervalKey = "availableCheckInterval"
+
+const defaultAvailableCheckInterval = 1000
+
 type DefaultExporter struct {
 	url        *motan.URL
 	Registrys  []motan.Registry
 	extFactory motan.ExtentionFactory
 	server     motan.Server
 	provider   motan.Provider
+	stopCh     chan struct{}
+	Switcher   func() bool // whether services are switched available manually, e.g. by the 200/503 of agent. nil means available
 
 	// 服务管理单位，负责服务注册、心跳、导出和销毁，内部包含provider，与provider是一对一关系
 }
@@ -75,11 +85,56 @@ func (d *DefaultExporter) Export(server motan.Server, extFactory motan.Extention
 	}
 	d.Registrys = registries
 	// TODO heartbeat or 200 switcher
+	d.stopCh = make(chan struct{})
+	go d.watchAvailable(d.stopCh, d.url.GetTimeDuration(AvailableCheckIntervalKey, time.Millisecond, defaultAvailableCheckInterval*time.Millisecond))
 	vlog.Infof("export url %s success.\n", d.url.GetIdentity())
 	return nil
 }
 
+// watchAvailable set the service unavailable in registries when the provider is unavailable, and set it available
+// again when the provider recovers. the service is only restored if it is switched available manually.
+// unavailability is asserted on every check while the provider is unavailable, because the service may be switched
+// available manually in the meantime.
+func (d *DefaultExporter) watchAvailable(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	unavailable := false // the service is set unavailable by the watcher
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if !d.provider.IsAvailable() {
+				if !unavailable {
+					vlog.Infof("service availability changed. url:%s, available:false\n", d.url.GetIdentity())
+				}
+				unavailable = true
+				for _, r := range d.Registrys {
+					r.Unavailable(d.url)
+				}
+				continue
+			}
+			if !unavailable {
+				continue
+			}
+			unavailable = false
+			if d.Switcher != nil && !d.Switcher() {
+				vlog.Infof("provider is available but service is switched unavailable. url:%s\n", d.url.GetIdentity())
+				continue
+			}
+			for _, r := range d.Registrys {
+				r.Available(d.url)
+			}
+			vlog.Infof("service availability changed. url:%s, available:true\n", d.url.GetIdentity())
+		}
+	}
+}
+
 func (d *DefaultExporter) Unexport() error {
+	if d.stopCh != nil {
+		close(d.stopCh)
+		d.stopCh = nil
+	}
 	for _, r := range d.Registrys {
 		r.UnRegister(d.url)
 	}
@@ -105,6 +160,7 @@ func (d *DefaultExporter) SetURL(url *motan.URL) {
 
 type DefaultMessageHandler struct {
 	providers map[string]motan.Provider
+	lock      sync.RWMutex
 }
 
 func (d *DefaultMessageHandler) Initialize() {
@@ -112,11 +168,15 @@ func (d *DefaultMessageHandler) Initialize() {
 }
 
 func (d *DefaultMessageHandler) AddProvider(p motan.Provider) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	d.providers[p.GetPath()] = p
 	return nil
 }
 
 func (d *DefaultMessageHandler) RmProvider(p motan.Provider) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	dp := d.providers[p.GetPath()]
 	if dp != nil && p == dp {
 		delete(d.providers, p.GetPath())
@@ -124,11 +184,24 @@ func (d *DefaultMessageHandler) RmProvider(p motan.Provider) {
 }
 
 func (d *DefaultMessageHandler) GetProvider(serviceName string) motan.Provider {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
 	return d.providers[serviceName]
 }
 
+// GetProviders returns all providers of the handler
+func (d *DefaultMessageHandler) GetProviders() []motan.Provider {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	providers := make([]motan.Provider, 0, len(d.providers))
+	for _, p := range d.providers {
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 func (d *DefaultMessageHandler) Call(request motan.Request) (res motan.Response) {
-	p := d.providers[request.GetServiceName()]
+	p := d.GetProvider(request.GetServiceName())
 	if p != nil {
 		res = p.Call(request)
 		res.GetRPCContext(true).GzipSize = int(p.GetURL().GetIntValue(motan.GzipSizeKey, 0))
@@ -167,6 +240,14 @@ func (f *FilterProviderWarper) Destroy() {
 	f.provider.Destroy()
 }
 
+// GetMethods returns the methods of the warped provider if it can describe its methods
+func (f *FilterProviderWarper) GetMethods() []motan.MethodInfo {
+	if md, ok := f.provider.(motan.MethodDescriber); ok {
+		return md.GetMethods()
+	}
+	return nil
+}
+
 func (f *FilterProviderWarper) Call(request motan.Request) (res motan.Response) {
 	return f.filter.Filter(f.provider, request)
 }
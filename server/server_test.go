@@ -0,0 +1,79 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+)
+
+type switchProvider struct {
+	describedProvider
+	available int32
+}
+
+func (s *switchProvider) IsAvailable() bool { return atomic.LoadInt32(&s.available) == 1 }
+
+// stateRegistry records the availability of the service set by the last call
+type stateRegistry struct {
+	motan.TestRegistry
+	available, unavailable, state int32 // state is 1 if available
+}
+
+func (c *stateRegistry) Available(url *motan.URL) {
+	atomic.AddInt32(&c.available, 1)
+	atomic.StoreInt32(&c.state, 1)
+}
+
+func (c *stateRegistry) Unavailable(url *motan.URL) {
+	atomic.AddInt32(&c.unavailable, 1)
+	atomic.StoreInt32(&c.state, 0)
+}
+
+func TestWatchAvailable(t *testing.T) {
+	var switched int32
+	provider := &switchProvider{describedProvider: describedProvider{url: &motan.URL{Path: "test"}}, available: 1}
+	registry := &stateRegistry{state: 1}
+	exporter := &DefaultExporter{url: provider.url, provider: provider, Registrys: []motan.Registry{registry}, stopCh: make(chan struct{}),
+		Switcher: func() bool {
+			return atomic.LoadInt32(&switched) == 1
+		}}
+	go exporter.watchAvailable(exporter.stopCh, 5*time.Millisecond)
+	defer close(exporter.stopCh)
+
+	unavailable := func() bool { return atomic.LoadInt32(&registry.state) == 0 }
+	atomic.StoreInt32(&provider.available, 0)
+	if !waitFor(unavailable) {
+		t.Fatal("service should be unavailable when provider is unavailable")
+	}
+	// switched available manually while provider is still unavailable
+	registry.Available(provider.url)
+	if !waitFor(unavailable) {
+		t.Fatal("service should be set unavailable again while provider is unavailable")
+	}
+	// switched unavailable manually
+	atomic.StoreInt32(&provider.available, 1)
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&registry.available); n != 1 || !unavailable() {
+		t.Fatalf("service switched unavailable should not be restored. available:%d", n)
+	}
+	atomic.StoreInt32(&switched, 1)
+	atomic.StoreInt32(&provider.available, 0)
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&provider.available, 1)
+	if !waitFor(func() bool { return atomic.LoadInt32(&registry.state) == 1 }) {
+		t.Fatal("service should be restored when provider is available")
+	}
+}
+
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
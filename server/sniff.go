@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/weibocom/motan-go/log"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+var (
+	httpMethodPrefixes = [][]byte{
+		[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("DELETE "), []byte("HEAD "),
+		[]byte("OPTIONS "), []byte("PATCH "), []byte("TRACE "), []byte("CONNECT "),
+	}
+	httpSniffLength = 8 // length of "OPTIONS " and "CONNECT "
+
+	errListenerClosed = errors.New("http listener is closed")
+)
+
+// isMotanMagic check whether the first two bytes is the motan2 magic number
+func isMotanMagic(head []byte) bool {
+	return len(head) >= 2 && uint16(head[0])<<8|uint16(head[1]) == mpro.MotanMagic
+}
+
+// sniffHTTP check whether the connection starts with a http request line. it will not consume any data of the reader.
+func sniffHTTP(buf *bufio.Reader) bool {
+	head, _ := buf.Peek(httpSniffLength) // a http request line is always longer than sniff length, so a short peek is not http
+	for _, prefix := range httpMethodPrefixes {
+		if bytes.HasPrefix(head, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffedConn is a connection whose first bytes has been read into buffer when sniffing the protocol.
+type sniffedConn struct {
+	net.Conn
+	buf *bufio.Reader
+	sc  *serverConn
+
+	idleLock  sync.Mutex
+	idleTimer *time.Timer
+}
+
+func (s *sniffedConn) Read(p []byte) (int, error) {
+	return s.buf.Read(p)
+}
+
+// setIdle closes the connection if it keeps idle for the timeout. http.Server.IdleTimeout is not used because
+// it needs Go 1.8, and a read deadline set in idle state is reset by http.Server when it reads next request.
+func (s *sniffedConn) setIdle(idle bool, timeout time.Duration) {
+	s.idleLock.Lock()
+	defer s.idleLock.Unlock()
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	if idle && timeout > 0 {
+		s.idleTimer = time.AfterFunc(timeout, func() {
+			vlog.Infof("motan server close idle http connection. con:%s, idle:%v\n", s.RemoteAddr().String(), timeout)
+			s.Close()
+		})
+	}
+}
+
+// connListener is a net.Listener which accepts connections handed over by motan server, so the sniffed http
+// connections can be served by a standard http.Server.
+type connListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, conns: make(chan net.Conn), closeCh: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closeCh:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closeCh)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// serve hand over the connection to the http server
+func (l *connListener) serve(conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.closeCh:
+		return errListenerClosed
+	}
+}
+
+// httpServer serves the http connections sniffed from motan server port with the http handler
+type httpServer struct {
+	listener *connListener
+	server   *http.Server
+}
+
+func newHTTPServer(addr net.Addr, handler http.Handler, conns *connManager, idleTimeout time.Duration) *httpServer {
+	h := &httpServer{listener: newConnListener(addr)}
+	h.server = &http.Server{
+		Handler: handler,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			sniffed, ok := conn.(*sniffedConn)
+			if !ok {
+				return
+			}
+			switch state {
+			case http.StateActive:
+				sniffed.setIdle(false, idleTimeout)
+				sniffed.sc.active(true)
+			case http.StateIdle:
+				sniffed.setIdle(true, idleTimeout)
+			case http.StateClosed, http.StateHijacked:
+				sniffed.setIdle(false, idleTimeout)
+				conns.remove(sniffed.sc)
+			}
+		},
+	}
+	go func() {
+		if err := h.server.Serve(h.listener); err != nil && err != errListenerClosed {
+			vlog.Warningf("motan server http serve fail. addr:%s, err:%s\n", addr.String(), err.Error())
+		}
+	}()
+	return h
+}
+
+func (h *httpServer) serve(sc *serverConn, buf *bufio.Reader) error {
+	return h.listener.serve(&sniffedConn{Conn: sc.conn, buf: buf, sc: sc})
+}
+
+func (h *httpServer) close() {
+	h.listener.Close()
+}
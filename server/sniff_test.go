@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+func TestProtocolSniff(t *testing.T) {
+	server := &MotanServer{URL: &motan.URL{Port: 0}}
+	server.SetHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok:" + r.URL.Path))
+	}))
+	if err := server.Open(false, false, &DefaultMessageHandler{}, nil); err != nil {
+		t.Fatalf("open server fail. err:%v", err)
+	}
+	defer server.Destroy()
+	addr := server.listener.Addr().String()
+
+	res, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("http request fail. err:%v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "ok:/health" {
+		t.Fatalf("http response not correct. body:%s", body)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("connect fail. err:%v", err)
+	}
+	defer conn.Close()
+	conn.Write(mpro.BuildHeartbeat(123, mpro.Req).Encode().Bytes())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	msg, err := mpro.Decode(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("decode heartbeat response fail. err:%v", err)
+	}
+	if !msg.Header.IsHeartbeat() || msg.Header.RequestID != 123 {
+		t.Fatalf("heartbeat response not correct. header:%+v", msg.Header)
+	}
+	if len(server.GetConnections()) != 2 {
+		t.Fatalf("connection count not correct. count:%d", len(server.GetConnections()))
+	}
+}
+
+func TestHTTPIdleTimeout(t *testing.T) {
+	server := &MotanServer{URL: &motan.URL{Port: 0, Parameters: map[string]string{IdleTimeoutKey: "50"}}}
+	server.SetHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if err := server.Open(false, false, &DefaultMessageHandler{}, nil); err != nil {
+		t.Fatalf("open server fail. err:%v", err)
+	}
+	defer server.Destroy()
+
+	conn, err := net.DialTimeout("tcp", server.listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("connect fail. err:%v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ { // keep-alive connection is not closed while it is used
+		conn.Write([]byte("GET /health HTTP/1.1\r\nHost: test\r\n\r\n"))
+		res, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("http request fail. err:%v", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := reader.ReadByte(); err == nil {
+		t.Fatal("idle http connection should be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("idle http connection should be closed before read timeout")
+	}
+}
@@ -0,0 +1,93 @@
+package motan
+
+import (
+	"strings"
+	"testing"
+
+	motan "github.com/weibocom/motan-go/core"
+	mserver "github.com/weibocom/motan-go/server"
+)
+
+type testHelloService struct{}
+
+func (t *testHelloService) Hello(name string) string {
+	return "hello " + name
+}
+
+func TestMSContextExportService(t *testing.T) {
+	ext := &motan.DefaultExtentionFactory{}
+	ext.Initialize()
+	AddDefaultExt(ext)
+	ext.RegistExtRegistry("test", func(url *motan.URL) motan.Registry {
+		return &motan.TestRegistry{URL: url}
+	})
+	m := &MSContext{inited: true,
+		context:          &motan.Context{RegistryURLs: map[string]*motan.URL{"test-registry": {Protocol: "test", Host: "127.0.0.1", Port: 8002}}},
+		portService:      make(map[int]motan.Exporter),
+		portServer:       make(map[int]motan.Server),
+		serviceImpls:     make(map[string]interface{}),
+		registries:       make(map[string]motan.Registry),
+		serviceExporters: make(map[string]*mserver.DefaultExporter),
+	}
+	newURL := func(path string, params map[string]string) *motan.URL {
+		url := &motan.URL{Path: path, Group: "test-group", Parameters: map[string]string{motan.ExportKey: "motan2:0"}}
+		for k, v := range params {
+			url.Parameters[k] = v
+		}
+		return url
+	}
+	services := func() string {
+		var paths []string
+		for _, url := range m.GetExportServices() {
+			paths = append(paths, url.Path)
+		}
+		return strings.Join(paths, ",")
+	}
+	withRegistry := map[string]string{motan.RegistryKey: "test-registry"}
+	withRef := map[string]string{motan.RegistryKey: "test-registry", motan.RefKey: "motan.testHelloService"}
+
+	if err := m.ExportService(newURL("com.test.A", withRegistry), &testHelloService{}); err == nil {
+		t.Fatal("export before start should fail")
+	}
+	m.Start(ext)
+	// export fails without registry, and the provider and port are released
+	if err := m.ExportService(newURL("com.test.A", nil), &testHelloService{}); err == nil {
+		t.Fatal("export without registry should fail")
+	}
+	if services() != "" || len(m.portServer) != 0 {
+		t.Fatalf("failed export should be rolled back. services:%s, servers:%d", services(), len(m.portServer))
+	}
+
+	if err := m.ExportService(newURL("com.test.B", withRegistry), &testHelloService{}); err != nil {
+		t.Fatalf("export service fail. err:%v", err)
+	}
+	// the service registered before is used if service is nil
+	if err := m.ExportService(newURL("com.test.A", withRef), nil); err != nil {
+		t.Fatalf("export registered service fail. err:%v", err)
+	}
+	if services() != "com.test.A,com.test.B" {
+		t.Fatalf("exported services should be listed by path. services:%s", services())
+	}
+	if len(m.portServer) != 1 || len(m.registries) != 1 {
+		t.Fatalf("services should share the port and registry. servers:%d, registries:%d", len(m.portServer), len(m.registries))
+	}
+	if err := m.ExportService(newURL("com.test.A", withRef), nil); err == nil {
+		t.Fatal("duplicate export should fail")
+	}
+
+	if err := m.UnexportService("com.test.C"); err == nil {
+		t.Fatal("unexport of unknown service should fail")
+	}
+	if err := m.UnexportService("com.test.A"); err != nil {
+		t.Fatalf("unexport service fail. err:%v", err)
+	}
+	if services() != "com.test.B" || len(m.registries) != 1 {
+		t.Fatalf("registry should be kept while it is used. services:%s, registries:%d", services(), len(m.registries))
+	}
+	if err := m.UnexportService("com.test.B"); err != nil {
+		t.Fatalf("unexport service fail. err:%v", err)
+	}
+	if services() != "" || len(m.portServer) != 0 || len(m.registries) != 0 {
+		t.Fatalf("port and registry should be released. servers:%d, registries:%d", len(m.portServer), len(m.registries))
+	}
+}